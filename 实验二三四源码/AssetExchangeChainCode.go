@@ -1,24 +1,235 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
 	"github.com/hyperledger/fabric-protos-go/peer"
 )
 
 // User 用户
 type User struct {
-	Name   string   `json:"name"`
-	ID     string   `json:"id"`
-	Assets []string `json:"assets"`
+	Name  string `json:"name"`
+	ID    string `json:"id"`
+	MSPID string `json:"msp_id,omitempty"` //注册时客户端所属组织，资产键级背书策略要求该组织背书
+	//旧版本保存的资产列表，仅用于迁移，持有关系以owner~asset索引为准
+	Assets []string `json:"assets,omitempty"`
 }
 
 // Asset 资产
 type Asset struct {
+	Name        string `json:"name"`
+	ID          string `json:"id"`
+	Metadata    string `json:"metadata"`
+	Owner       string `json:"owner,omitempty"`        //登记拥有者
+	TotalShares int64  `json:"total_shares,omitempty"` //拆分的总份额，0表示未拆分
+	Class       string `json:"class,omitempty"`        //资产类别，元数据需符合类别的JSON Schema
+	MetadataVer int64  `json:"metadata_version,omitempty"`
+}
+
+// AssetClass 资产类别
+type AssetClass struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Schema    json.RawMessage `json:"schema"` //元数据JSON Schema
+	CreatedBy string          `json:"created_by"`
+	Royalties []*RoyaltyRule  `json:"royalties,omitempty"` //有偿转让时的版税分成
+}
+
+// RoyaltyRule 版税分成规则，费率单位为万分之一
+type RoyaltyRule struct {
+	RecipientID string `json:"recipient_id"`
+	RateBps     int64  `json:"rate_bps"`
+}
+
+// PaymentRecord 有偿转让的付款分账记录
+type PaymentRecord struct {
+	AssetID   string          `json:"asset_id"`
+	TxID      string          `json:"tx_id"`
+	Timestamp int64           `json:"timestamp"`
+	SellerID  string          `json:"seller_id"`
+	BuyerID   string          `json:"buyer_id"`
+	Price     int64           `json:"price"`
+	Splits    []*PaymentSplit `json:"splits"`
+}
+
+// PaymentSplit 分账明细
+type PaymentSplit struct {
+	RecipientID string `json:"recipient_id"`
+	Role        string `json:"role"` //seller、royalty或platform_fee
+	Amount      int64  `json:"amount"`
+}
+
+// AssetMetadataVersion 资产元数据历史版本
+type AssetMetadataVersion struct {
+	AssetID      string `json:"asset_id"`
+	Version      int64  `json:"version"`
+	Metadata     string `json:"metadata"`
+	SupersededBy string `json:"superseded_by,omitempty"` //被新版本替换的交易ID，当前版本为空
+	SupersededAt int64  `json:"superseded_at,omitempty"`
+}
+
+// EnrollRequest 资产登记请求
+type EnrollRequest struct {
 	Name     string `json:"name"`
 	ID       string `json:"id"`
 	Metadata string `json:"metadata"`
+	OwnerID  string `json:"owner_id"`
+	Class    string `json:"class,omitempty"`
+}
+
+// TransferRequest 资产转让请求
+type TransferRequest struct {
+	OwnerID    string `json:"owner_id"`
+	AssetID    string `json:"asset_id"`
+	NewOwnerID string `json:"new_owner_id"`
+	OperatorID string `json:"operator_id,omitempty"`
+}
+
+// BatchItemResult 批量操作的逐项结果
+type BatchItemResult struct {
+	Index   int    `json:"index"`
+	ID      string `json:"id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// AssetPage 资产分页查询结果
+type AssetPage struct {
+	Assets   []*Asset `json:"assets"`
+	Count    int32    `json:"count"`
+	Bookmark string   `json:"bookmark"`
+}
+
+// ConsistencyReport 资产一致性检查结果
+type ConsistencyReport struct {
+	Assets          int                 `json:"assets"`
+	DuplicateOwners []*AssetOwnersIssue `json:"duplicate_owners"` //被多个用户登记拥有的资产
+	OwnerMismatches []*AssetOwnersIssue `json:"owner_mismatches"` //资产记录与拥有者索引不一致
+	DuplicateNames  []*AssetNameIssue   `json:"duplicate_names"`
+	OrphanIndexes   []string            `json:"orphan_indexes"` //拥有者索引指向不存在的资产
+	MissingIndexes  int                 `json:"missing_indexes"`
+}
+
+// AssetOwnersIssue 资产拥有关系异常
+type AssetOwnersIssue struct {
+	AssetID string   `json:"asset_id"`
+	Owner   string   `json:"owner"`
+	Indexed []string `json:"indexed"`
+}
+
+// AssetNameIssue 重复的资产名称
+type AssetNameIssue struct {
+	Name     string   `json:"name"`
+	AssetIDs []string `json:"asset_ids"`
+}
+
+// MigrationResult 用户资产列表迁移结果
+type MigrationResult struct {
+	Users    int    `json:"users"`
+	Assets   int    `json:"assets"`
+	Bookmark string `json:"bookmark"` //下一批的起始键，为空表示迁移完成
+}
+
+// AssetEndorsementPolicy 资产键的有效背书策略
+type AssetEndorsementPolicy struct {
+	AssetID  string   `json:"asset_id"`
+	KeyLevel bool     `json:"key_level"` //false表示使用链码级背书策略
+	Orgs     []string `json:"orgs"`
+}
+
+// AssetTombstone 资产注销记录，保留注销前的资产信息
+type AssetTombstone struct {
+	Asset     *Asset `json:"asset"`
+	OwnerID   string `json:"owner_id"`
+	Reason    string `json:"reason"`
+	RetiredAt int64  `json:"retired_at"`
+	TxID      string `json:"tx_id"`
+}
+
+// Config 链码配置，实例化/升级时通过Init参数写入
+type Config struct {
+	RegulatorMSP string `json:"regulator_msp"`  //监管组织，可冻结和解冻资产
+	AdminMSP     string `json:"admin_msp"`      //管理组织，可登记资产类别
+	UniqueNames  bool   `json:"unique_names"`   //是否要求资产名称唯一
+	MaxBatchSize int    `json:"max_batch_size"` //批量操作最大条数，0表示使用默认值
+	FeeAccount   string `json:"fee_account"`    //平台手续费收款用户
+	FeeRateBps   int64  `json:"fee_rate_bps"`   //平台手续费率，单位为万分之一
+}
+
+// AssetLock 资产冻结（监管扣押）记录
+type AssetLock struct {
+	AssetID   string `json:"asset_id"`
+	Reason    string `json:"reason"`    //冻结原因代码
+	LockedBy  string `json:"locked_by"` //执行冻结的监管组织
+	LockedAt  int64  `json:"locked_at"`
+	ExpiresAt int64  `json:"expires_at,omitempty"` //到期自动解冻时间，0表示不过期
+}
+
+// AssetLease 资产租约，承租人在租期内享有资产使用权，所有权不变
+type AssetLease struct {
+	ID            string `json:"id"`
+	AssetID       string `json:"asset_id"`
+	LessorID      string `json:"lessor_id"` //出租时的资产拥有者
+	LesseeID      string `json:"lessee_id"`
+	Start         int64  `json:"start"`          //租期开始时间（unix秒）
+	End           int64  `json:"end"`            //租期结束时间（unix秒），不含
+	BlockTransfer bool   `json:"block_transfer"` //为true时租约结束前禁止转让，否则租约随资产转移
+	GrantedAt     int64  `json:"granted_at"`
+	TerminatedAt  int64  `json:"terminated_at,omitempty"` //提前终止时间
+}
+
+// AssetHTLC 资产哈希时间锁，接收方在超时前出示原像即可取得资产，超时后锁定解除
+type AssetHTLC struct {
+	AssetID    string `json:"asset_id"`
+	SenderID   string `json:"sender_id"`
+	ReceiverID string `json:"receiver_id"`
+	HashLock   string `json:"hash_lock"` //原像的sha256，十六进制
+	Timeout    int64  `json:"timeout"`   //超时时间（unix秒）
+	Status     string `json:"status"`
+	Preimage   string `json:"preimage,omitempty"` //领取时公开的原像，供对方链上领取
+	LockedAt   int64  `json:"locked_at"`
+	SettledAt  int64  `json:"settled_at,omitempty"`
+	TxID       string `json:"tx_id"` //锁定交易ID
+}
+
+// RightsHolder 某一时刻的资产使用权人
+type RightsHolder struct {
+	AssetID  string `json:"asset_id"`
+	OwnerID  string `json:"owner_id"`
+	HolderID string `json:"holder_id"`          //使用权人，无有效租约时为拥有者
+	LeaseID  string `json:"lease_id,omitempty"` //生效中的租约
+	At       int64  `json:"at"`
+}
+
+// AssetShare 资产份额
+type AssetShare struct {
+	AssetID  string `json:"asset_id"`
+	HolderID string `json:"holder_id"`
+	Quantity int64  `json:"quantity"`
+}
+
+// CapTable 资产份额登记册
+type CapTable struct {
+	AssetID     string        `json:"asset_id"`
+	TotalShares int64         `json:"total_shares"`
+	Shares      []*AssetShare `json:"shares"`
 }
 
 // AssetHistory 资产变更记录
@@ -26,13 +237,113 @@ type AssetHistory struct {
 	AssetID        string `json:"asset_id"`
 	OriginOwnerID  string `json:"origin_owner_id"`
 	CurrentOwnerID string `json:"current_owner_id"`
+	Seq            int64  `json:"seq"`                   //资产内单调递增序号，旧记录为0
+	TxID           string `json:"tx_id"`                 //变更交易ID
+	Timestamp      int64  `json:"timestamp"`             //变更交易时间（unix秒）
+	OperatorID     string `json:"operator_id,omitempty"` //代为执行转让的操作员
+}
+
+// AssetApproval 单个资产的操作员授权
+type AssetApproval struct {
+	AssetID    string `json:"asset_id"`
+	OwnerID    string `json:"owner_id"`
+	OperatorID string `json:"operator_id"`
+}
+
+// OperatorApproval 用户对操作员的全部资产授权
+type OperatorApproval struct {
+	OwnerID    string `json:"owner_id"`
+	OperatorID string `json:"operator_id"`
+	Approved   bool   `json:"approved"`
+}
+
+// OwnershipAt 某一时刻的资产拥有情况
+type OwnershipAt struct {
+	AssetID string `json:"asset_id"`
+	OwnerID string `json:"owner_id"`
+	At      int64  `json:"at"`    //查询时刻（unix秒）
+	Since   int64  `json:"since"` //成为拥有者的时间
+	TxID    string `json:"tx_id"` //成为拥有者的交易ID
+	Seq     int64  `json:"seq"`   //对应的资产变更记录序号
+}
+
+// AssetProvenance 根据资产键的账本历史还原的拥有者变更
+type AssetProvenance struct {
+	TxID      string `json:"tx_id"`
+	Timestamp int64  `json:"timestamp"`
+	OwnerID   string `json:"owner_id"`
+	IsDelete  bool   `json:"is_delete"`
+}
+
+// Auction 密封竞价拍卖
+type Auction struct {
+	ID             string `json:"id"`
+	AssetID        string `json:"asset_id"`
+	SellerID       string `json:"seller_id"`
+	BidDeadline    int64  `json:"bid_deadline"`    //出价截止时间（unix秒）
+	RevealDeadline int64  `json:"reveal_deadline"` //揭示截止时间（unix秒）
+	Status         string `json:"status"`
+	WinnerID       string `json:"winner_id,omitempty"`
+	WinningPrice   int64  `json:"winning_price,omitempty"`
+}
+
+// AuctionBid 链上出价承诺，揭示后记录出价
+type AuctionBid struct {
+	AuctionID string `json:"auction_id"`
+	BidID     string `json:"bid_id"`
+	BidderID  string `json:"bidder_id"`
+	BidderOrg string `json:"bidder_org"`
+	Hash      string `json:"hash"`
+	Timestamp int64  `json:"timestamp"`
+	Revealed  bool   `json:"revealed"`
+	Price     int64  `json:"price,omitempty"`
+}
+
+// PrivateBid 保存在出价方组织私有数据集合中的出价
+type PrivateBid struct {
+	AuctionID string `json:"auction_id"`
+	BidderID  string `json:"bidder_id"`
+	Price     int64  `json:"price"`
+	Salt      string `json:"salt"`
+}
+
+//拍卖状态
+const (
+	auctionOpen   = "open"
+	auctionClosed = "closed"
+)
+
+//哈希时间锁状态
+const (
+	htlcLocked   = "locked"
+	htlcClaimed  = "claimed"
+	htlcRefunded = "refunded"
+)
+
+//原始用户占位符、资产注销后的拥有者占位符
+const (
+	originOwner  = "originOwnerPlaceholder"
+	retiredOwner = "retiredOwnerPlaceholder"
+)
+
+//资产冻结原因代码
+var lockReasons = map[string]bool{
+	"dispute":       true, //所有权争议
+	"court_order":   true, //法院裁定
+	"investigation": true, //监管调查
+	"sanction":      true, //制裁
+	"other":         true,
 }
 
-//原始用户占位符
+//分页查询默认每页条数、批量操作默认最大条数
 const (
-	originOwner = "originOwnerPlaceholder"
+	defaultPageSize     = 100
+	defaultMaxBatchSize = 100
 )
 
+//费率分母，费率以万分之一为单位
+const bpsDenominator = 10000
+
 func constructUserKey(userId string) string {
 	return fmt.Sprintf("user_%s", userId)
 }
@@ -40,196 +351,3386 @@ func constructAssetKey(assetID string) string {
 	return fmt.Sprintf("asset_%s", assetID)
 }
 
-//用户注册（开户）
-func userRegister(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+func constructAuctionKey(auctionID string) string {
+	return fmt.Sprintf("auction_%s", auctionID)
+}
+func constructAssetAuctionKey(assetID string) string {
+	return fmt.Sprintf("auctionAsset_%s", assetID)
+}
+func implicitCollection(mspID string) string {
+	return fmt.Sprintf("_implicit_org_%s", mspID)
+}
+
+//获取交易时间，链码中不能使用本地时间
+func getTxTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("get tx timestamp error %s", err)
+	}
+	return time.Unix(ts.GetSeconds(), int64(ts.GetNanos())).UTC(), nil
+}
+
+const configKey = "config"
+
+func constructAssetClassKey(classID string) string {
+	return fmt.Sprintf("assetClass_%s", classID)
+}
+
+func getAssetClass(stub shim.ChaincodeStubInterface, classID string) (*AssetClass, error) {
+	classBytes, err := stub.GetState(constructAssetClassKey(classID))
+	if err != nil || len(classBytes) == 0 {
+		return nil, fmt.Errorf("asset class not found")
+	}
+	class := new(AssetClass)
+	if err := json.Unmarshal(classBytes, class); err != nil {
+		return nil, fmt.Errorf("unmarshal asset class error %s", err)
+	}
+	return class, nil
+}
+
+//校验元数据是否符合资产类别的JSON Schema，未指定类别时不校验
+func validateAssetMetadata(stub shim.ChaincodeStubInterface, classID, metadata string) error {
+	if classID == "" {
+		return nil
+	}
+	class, err := getAssetClass(stub, classID)
+	if err != nil {
+		return err
+	}
+	schema := make(map[string]interface{})
+	if err := json.Unmarshal(class.Schema, &schema); err != nil {
+		return fmt.Errorf("unmarshal schema error %s", err)
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(metadata), &value); err != nil {
+		return fmt.Errorf("metadata is not valid json %s", err)
+	}
+	if err := validateJSONSchema(schema, value, "metadata"); err != nil {
+		return fmt.Errorf("metadata does not match class %s schema: %s", classID, err)
+	}
+	return nil
+}
+
+func constructTombstoneKey(assetID string) string {
+	return fmt.Sprintf("tombstone_%s", assetID)
+}
+
+//查询资产注销记录，未注销时返回nil
+func getAssetTombstone(stub shim.ChaincodeStubInterface, assetID string) (*AssetTombstone, error) {
+	tombstoneBytes, err := stub.GetState(constructTombstoneKey(assetID))
+	if err != nil {
+		return nil, fmt.Errorf("query tombstone error %s", err)
+	}
+	if len(tombstoneBytes) == 0 {
+		return nil, nil
+	}
+	tombstone := new(AssetTombstone)
+	if err := json.Unmarshal(tombstoneBytes, tombstone); err != nil {
+		return nil, fmt.Errorf("unmarshal tombstone error %s", err)
+	}
+	return tombstone, nil
+}
+
+func constructHTLCKey(assetID string) string {
+	return fmt.Sprintf("htlc_%s", assetID)
+}
+
+//查询资产哈希时间锁，不存在时返回nil
+func getAssetHTLC(stub shim.ChaincodeStubInterface, assetID string) (*AssetHTLC, error) {
+	htlcBytes, err := stub.GetState(constructHTLCKey(assetID))
+	if err != nil {
+		return nil, fmt.Errorf("query htlc error %s", err)
+	}
+	if len(htlcBytes) == 0 {
+		return nil, nil
+	}
+	htlc := new(AssetHTLC)
+	if err := json.Unmarshal(htlcBytes, htlc); err != nil {
+		return nil, fmt.Errorf("unmarshal htlc error %s", err)
+	}
+	return htlc, nil
+}
+
+func putAssetHTLC(stub shim.ChaincodeStubInterface, htlc *AssetHTLC) ([]byte, error) {
+	htlcBytes, err := json.Marshal(htlc)
+	if err != nil {
+		return nil, fmt.Errorf("marshal htlc error %s", err)
+	}
+	if err := stub.PutState(constructHTLCKey(htlc.AssetID), htlcBytes); err != nil {
+		return nil, fmt.Errorf("save htlc error %s", err)
+	}
+	return htlcBytes, nil
+}
+
+func constructLockKey(assetID string) string {
+	return fmt.Sprintf("lock_%s", assetID)
+}
+
+func getConfig(stub shim.ChaincodeStubInterface) (*Config, error) {
+	config := new(Config)
+	configBytes, err := stub.GetState(configKey)
+	if err != nil {
+		return nil, fmt.Errorf("query config error %s", err)
+	}
+	if len(configBytes) == 0 {
+		return config, nil
+	}
+	if err := json.Unmarshal(configBytes, config); err != nil {
+		return nil, fmt.Errorf("unmarshal config error %s", err)
+	}
+	return config, nil
+}
+
+//检查调用者是否属于监管组织
+func checkRegulator(stub shim.ChaincodeStubInterface) (string, error) {
+	config, err := getConfig(stub)
+	if err != nil {
+		return "", err
+	}
+	return checkCallerOrg(stub, config.RegulatorMSP, "regulator")
+}
+
+//检查调用者是否属于管理组织
+func checkAdmin(stub shim.ChaincodeStubInterface) (string, error) {
+	config, err := getConfig(stub)
+	if err != nil {
+		return "", err
+	}
+	return checkCallerOrg(stub, config.AdminMSP, "admin")
+}
+
+//检查调用者是否属于用户注册时的组织，即有权代表该用户操作
+func checkCallerIsUser(stub shim.ChaincodeStubInterface, userID string) error {
+	user, err := getUser(stub, userID)
+	if err != nil {
+		return err
+	}
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return fmt.Errorf("get msp id error %s", err)
+	}
+	if user.MSPID == "" || user.MSPID != mspID {
+		return fmt.Errorf("caller %s can not act for user %s", mspID, userID)
+	}
+	return nil
+}
+
+func checkCallerOrg(stub shim.ChaincodeStubInterface, expectedMSP, role string) (string, error) {
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return "", fmt.Errorf("get msp id error %s", err)
+	}
+	if expectedMSP == "" || mspID != expectedMSP {
+		return "", fmt.Errorf("caller %s is not the %s org", mspID, role)
+	}
+	return mspID, nil
+}
+
+func getUser(stub shim.ChaincodeStubInterface, userID string) (*User, error) {
+	userBytes, err := stub.GetState(constructUserKey(userID))
+	if err != nil || len(userBytes) == 0 {
+		return nil, fmt.Errorf("User not found")
+	}
+	user := new(User)
+	if err := json.Unmarshal(userBytes, user); err != nil {
+		return nil, fmt.Errorf("unmarshal user error %s", err)
+	}
+	return user, nil
+}
+
+func putUser(stub shim.ChaincodeStubInterface, user *User) error {
+	userBytes, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("marshal user error %s", err)
+	}
+	if err := stub.PutState(constructUserKey(user.ID), userBytes); err != nil {
+		return fmt.Errorf("update user error %s", err)
+	}
+	return nil
+}
+
+func constructOwnerIndexKey(stub shim.ChaincodeStubInterface, ownerID, assetID string) (string, error) {
+	return stub.CreateCompositeKey("owner~asset", []string{ownerID, assetID})
+}
+
+//检查用户是否为资产的登记拥有者
+func ownsAsset(stub shim.ChaincodeStubInterface, ownerID, assetID string) (bool, error) {
+	indexKey, err := constructOwnerIndexKey(stub, ownerID, assetID)
+	if err != nil {
+		return false, fmt.Errorf("create key error %s", err)
+	}
+	indexBytes, err := stub.GetState(indexKey)
+	if err != nil {
+		return false, fmt.Errorf("query owner index error %s", err)
+	}
+	if len(indexBytes) != 0 {
+		return true, nil
+	}
+	//资产仍记录在旧版本的资产列表中时提示先迁移
+	user, err := getUser(stub, ownerID)
+	if err != nil {
+		return false, err
+	}
+	for _, aid := range user.Assets {
+		if aid == assetID {
+			return false, fmt.Errorf("user %s assets not migrated, call migrateUserAssets first", ownerID)
+		}
+	}
+	return false, nil
+}
+
+//设置资产拥有者索引
+func putOwnerIndex(stub shim.ChaincodeStubInterface, ownerID, assetID string) error {
+	indexKey, err := constructOwnerIndexKey(stub, ownerID, assetID)
+	if err != nil {
+		return fmt.Errorf("create key error %s", err)
+	}
+	if err := stub.PutState(indexKey, []byte{0x00}); err != nil {
+		return fmt.Errorf("save owner index error %s", err)
+	}
+	return nil
+}
+
+//删除资产拥有者索引
+func delOwnerIndex(stub shim.ChaincodeStubInterface, ownerID, assetID string) error {
+	indexKey, err := constructOwnerIndexKey(stub, ownerID, assetID)
+	if err != nil {
+		return fmt.Errorf("create key error %s", err)
+	}
+	if err := stub.DelState(indexKey); err != nil {
+		return fmt.Errorf("delete owner index error %s", err)
+	}
+	return nil
+}
+
+//查询用户登记拥有的全部资产ID
+func getOwnedAssetIDs(stub shim.ChaincodeStubInterface, ownerID string) ([]string, error) {
+	result, err := stub.GetStateByPartialCompositeKey("owner~asset", []string{ownerID})
+	if err != nil {
+		return nil, fmt.Errorf("query owner index error %s", err)
+	}
+	defer result.Close()
+	assetIDs := make([]string, 0)
+	for result.HasNext() {
+		indexVal, err := result.Next()
+		if err != nil {
+			return nil, fmt.Errorf("query error %s", err)
+		}
+		_, attrs, err := stub.SplitCompositeKey(indexVal.GetKey())
+		if err != nil {
+			return nil, fmt.Errorf("split key error %s", err)
+		}
+		assetIDs = append(assetIDs, attrs[1])
+	}
+	return assetIDs, nil
+}
+
+func getAsset(stub shim.ChaincodeStubInterface, assetID string) (*Asset, error) {
+	assetBytes, err := stub.GetState(constructAssetKey(assetID))
+	if err != nil || len(assetBytes) == 0 {
+		return nil, fmt.Errorf("asset not found")
+	}
+	asset := new(Asset)
+	if err := json.Unmarshal(assetBytes, asset); err != nil {
+		return nil, fmt.Errorf("unmarshal asset error %s", err)
+	}
+	return asset, nil
+}
+
+func putAsset(stub shim.ChaincodeStubInterface, asset *Asset) error {
+	assetBytes, err := json.Marshal(asset)
+	if err != nil {
+		return fmt.Errorf("marshal asset error %s", err)
+	}
+	if err := stub.PutState(constructAssetKey(asset.ID), assetBytes); err != nil {
+		return fmt.Errorf("save asset error %s", err)
+	}
+	return nil
+}
+
+func constructHistorySeqKey(assetID string) string {
+	return fmt.Sprintf("historySeq_%s", assetID)
+}
+
+//写入资产变更记录，按资产内序号排列，同一对拥有者之间的多次转让不会相互覆盖
+func putAssetHistory(stub shim.ChaincodeStubInterface, assetID, fromID, toID, operatorID string) ([]byte, error) {
+	seqBytes, err := stub.GetState(constructHistorySeqKey(assetID))
+	if err != nil {
+		return nil, fmt.Errorf("query history seq error %s", err)
+	}
+	var seq int64
+	if len(seqBytes) != 0 {
+		if seq, err = strconv.ParseInt(string(seqBytes), 10, 64); err != nil {
+			return nil, fmt.Errorf("parse history seq error %s", err)
+		}
+	}
+	seq++
+	now, err := getTxTime(stub)
+	if err != nil {
+		return nil, err
+	}
+	history := &AssetHistory{
+		AssetID:        assetID,
+		OriginOwnerID:  fromID,
+		CurrentOwnerID: toID,
+		Seq:            seq,
+		TxID:           stub.GetTxID(),
+		Timestamp:      now.Unix(),
+		OperatorID:     operatorID,
+	}
+	historyBytes, err := json.Marshal(history)
+	if err != nil {
+		return nil, fmt.Errorf("marshal asset history error %s", err)
+	}
+	historyKey, err := stub.CreateCompositeKey("history", []string{
+		assetID, fmt.Sprintf("%020d", seq),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create key error %s", err)
+	}
+	if err := stub.PutState(historyKey, historyBytes); err != nil {
+		return nil, fmt.Errorf("save asset history error %s", err)
+	}
+	if err := stub.PutState(constructHistorySeqKey(assetID), []byte(strconv.FormatInt(seq, 10))); err != nil {
+		return nil, fmt.Errorf("save history seq error %s", err)
+	}
+	if toID == retiredOwner {
+		return historyBytes, nil
+	}
+	//记录用户曾经持有过的资产，用于按时间点查询持有情况
+	ownedKey, err := stub.CreateCompositeKey("ownerHistory", []string{toID, assetID})
+	if err != nil {
+		return nil, fmt.Errorf("create key error %s", err)
+	}
+	if err := stub.PutState(ownedKey, []byte{0x00}); err != nil {
+		return nil, fmt.Errorf("save owner history error %s", err)
+	}
+	return historyBytes, nil
+}
+
+//解析查询时刻，支持RFC3339格式或2006-01-02日期，仅有日期时取当天结束时的状态
+//链码无法获取交易所在区块号，不支持按区块高度查询
+func parseQueryTime(value string) (int64, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Unix(), nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t.AddDate(0, 0, 1).Unix() - 1, nil
+	}
+	if _, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return 0, fmt.Errorf("block height %s is not supported, query by RFC3339 time or 2006-01-02 date", value)
+	}
+	return 0, fmt.Errorf("invalid time %s, expecting RFC3339 or 2006-01-02", value)
+}
+
+//根据变更记录计算资产在某一时刻的拥有者，资产尚未登记时返回nil
+//旧记录没有时间戳，视为早于所有带时间戳的记录
+func ownershipAt(stub shim.ChaincodeStubInterface, assetID string, at int64) (*OwnershipAt, error) {
+	histories, err := getAssetHistories(stub, assetID)
+	if err != nil {
+		return nil, err
+	}
+	var ownership *OwnershipAt
+	for _, history := range histories {
+		if history.Timestamp > at {
+			break
+		}
+		ownership = &OwnershipAt{
+			AssetID: assetID,
+			OwnerID: history.CurrentOwnerID,
+			At:      at,
+			Since:   history.Timestamp,
+			TxID:    history.TxID,
+			Seq:     history.Seq,
+		}
+	}
+	return ownership, nil
+}
+
+//查询资产全部变更记录，按序号排序；history~assetID~from~to格式的旧记录序号为0，排在最前
+func getAssetHistories(stub shim.ChaincodeStubInterface, assetID string) ([]*AssetHistory, error) {
+	result, err := stub.GetStateByPartialCompositeKey("history", []string{assetID})
+	if err != nil {
+		return nil, fmt.Errorf("query history error:%s", err)
+	}
+	defer result.Close()
+
+	histories := make([]*AssetHistory, 0)
+	for result.HasNext() {
+		historyVal, err := result.Next()
+		if err != nil {
+			return nil, fmt.Errorf("query error:%s", err)
+		}
+		history := new(AssetHistory)
+		if err := json.Unmarshal(historyVal.GetValue(), history); err != nil {
+			return nil, fmt.Errorf("unmashal error:%s", err)
+		}
+		histories = append(histories, history)
+	}
+	sort.SliceStable(histories, func(i, j int) bool {
+		return histories[i].Seq < histories[j].Seq
+	})
+	return histories, nil
+}
+
+//解析可选的分页参数：每页条数、书签
+func parsePageArgs(args []string) (int32, string, error) {
+	if len(args) == 0 {
+		return defaultPageSize, "", nil
+	}
+	size, err := strconv.ParseInt(args[0], 10, 32)
+	if err != nil || size <= 0 || len(args) != 2 {
+		return 0, "", fmt.Errorf("Invalid args")
+	}
+	return int32(size), args[1], nil
+}
+
+//按资产索引分页查询资产，索引键的最后一个属性为资产ID
+func queryAssetIndexPage(stub shim.ChaincodeStubInterface, index string, attrs []string, pageSize int32, bookmark string) ([]byte, error) {
+	result, metadata, err := stub.GetStateByPartialCompositeKeyWithPagination(index, attrs, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("query %s index error:%s", index, err)
+	}
+	defer result.Close()
+
+	page := &AssetPage{Assets: make([]*Asset, 0)}
+	for result.HasNext() {
+		indexVal, err := result.Next()
+		if err != nil {
+			return nil, fmt.Errorf("query error:%s", err)
+		}
+		_, keyAttrs, err := stub.SplitCompositeKey(indexVal.GetKey())
+		if err != nil {
+			return nil, fmt.Errorf("split key error:%s", err)
+		}
+		asset, err := getAsset(stub, keyAttrs[len(keyAttrs)-1])
+		if err != nil {
+			return nil, err
+		}
+		page.Assets = append(page.Assets, asset)
+	}
+	page.Count = metadata.GetFetchedRecordsCount()
+	page.Bookmark = metadata.GetBookmark()
+	pageBytes, err := json.Marshal(page)
+	if err != nil {
+		return nil, fmt.Errorf("marshal error %s", err)
+	}
+	return pageBytes, nil
+}
+
+//设置或删除资产的名称、类别二级索引
+func updateAssetIndexes(stub shim.ChaincodeStubInterface, asset *Asset, remove bool) error {
+	for _, index := range []struct {
+		name  string
+		attrs []string
+	}{
+		{"name~asset", []string{asset.Name, asset.ID}},
+		{"class~asset", []string{asset.Class, asset.ID}},
+	} {
+		if index.attrs[0] == "" {
+			continue
+		}
+		indexKey, err := stub.CreateCompositeKey(index.name, index.attrs)
+		if err != nil {
+			return fmt.Errorf("create key error %s", err)
+		}
+		if remove {
+			err = stub.DelState(indexKey)
+		} else {
+			err = stub.PutState(indexKey, []byte{0x00})
+		}
+		if err != nil {
+			return fmt.Errorf("update %s index error %s", index.name, err)
+		}
+	}
+	return nil
+}
+
+//检查资产名称是否已被使用
+func assetNameExists(stub shim.ChaincodeStubInterface, name string) (bool, error) {
+	result, err := stub.GetStateByPartialCompositeKey("name~asset", []string{name})
+	if err != nil {
+		return false, fmt.Errorf("query name index error %s", err)
+	}
+	defer result.Close()
+	return result.HasNext(), nil
+}
+
+//变更资产登记拥有者：更新拥有者索引、资产记录并写入变更记录，不改写用户数据
+//operatorID为代为转让的操作员，拥有者本人转让时为空；原拥有者的单资产授权随之失效
+func changeAssetOwner(stub shim.ChaincodeStubInterface, asset *Asset, fromID, toID, operatorID string) error {
+	if err := delOwnerIndex(stub, fromID, asset.ID); err != nil {
+		return err
+	}
+	if err := putOwnerIndex(stub, toID, asset.ID); err != nil {
+		return err
+	}
+	asset.Owner = toID
+	if err := putAsset(stub, asset); err != nil {
+		return err
+	}
+	if err := setAssetEndorsementPolicy(stub, asset.ID, toID); err != nil {
+		return err
+	}
+	if err := stub.DelState(constructApprovalKey(asset.ID)); err != nil {
+		return fmt.Errorf("delete approval error %s", err)
+	}
+	_, err := putAssetHistory(stub, asset.ID, fromID, toID, operatorID)
+	return err
+}
+
+//设置资产键级背书策略，要求资产拥有者所属组织的peer背书
+//拥有者没有组织信息（旧版本注册的用户）时清除键级策略，回退到链码级背书策略
+func setAssetEndorsementPolicy(stub shim.ChaincodeStubInterface, assetID, ownerID string) error {
+	owner, err := getUser(stub, ownerID)
+	if err != nil {
+		return err
+	}
+	var policy []byte
+	if owner.MSPID != "" {
+		ep, err := statebased.NewStateEP(nil)
+		if err != nil {
+			return fmt.Errorf("create endorsement policy error %s", err)
+		}
+		if err := ep.AddOrgs(statebased.RoleTypePeer, owner.MSPID); err != nil {
+			return fmt.Errorf("add endorsement org error %s", err)
+		}
+		if policy, err = ep.Policy(); err != nil {
+			return fmt.Errorf("marshal endorsement policy error %s", err)
+		}
+	}
+	if err := stub.SetStateValidationParameter(constructAssetKey(assetID), policy); err != nil {
+		return fmt.Errorf("set endorsement policy error %s", err)
+	}
+	return nil
+}
+
+//设置资产哈希时间锁定期间的键级背书策略：发送方或接收方组织任一背书即可，
+//使接收方可以在发送方拒绝背书时独立领取，发送方也可以在超时后独立退回
+//任一方未记录组织时改为使用链码级背书策略
+func setAssetHTLCEndorsementPolicy(stub shim.ChaincodeStubInterface, assetID, senderID, receiverID string) error {
+	sender, err := getUser(stub, senderID)
+	if err != nil {
+		return err
+	}
+	receiver, err := getUser(stub, receiverID)
+	if err != nil {
+		return err
+	}
+	var policy []byte
+	if sender.MSPID != "" && receiver.MSPID != "" {
+		//statebased只能生成要求全部组织背书的策略，这里直接构造1-of-n的签名策略
+		envelope := &common.SignaturePolicyEnvelope{Rule: &common.SignaturePolicy{
+			Type: &common.SignaturePolicy_NOutOf_{NOutOf: &common.SignaturePolicy_NOutOf{N: 1}},
+		}}
+		for i, mspID := range []string{sender.MSPID, receiver.MSPID} {
+			if i > 0 && mspID == sender.MSPID {
+				break
+			}
+			principal, err := proto.Marshal(&msp.MSPRole{MspIdentifier: mspID, Role: msp.MSPRole_PEER})
+			if err != nil {
+				return fmt.Errorf("marshal msp role error %s", err)
+			}
+			envelope.Identities = append(envelope.Identities, &msp.MSPPrincipal{
+				PrincipalClassification: msp.MSPPrincipal_ROLE,
+				Principal:               principal,
+			})
+			rules := envelope.Rule.GetNOutOf()
+			rules.Rules = append(rules.Rules, &common.SignaturePolicy{
+				Type: &common.SignaturePolicy_SignedBy{SignedBy: int32(i)},
+			})
+		}
+		if policy, err = proto.Marshal(envelope); err != nil {
+			return fmt.Errorf("marshal endorsement policy error %s", err)
+		}
+	}
+	if err := stub.SetStateValidationParameter(constructAssetKey(assetID), policy); err != nil {
+		return fmt.Errorf("set endorsement policy error %s", err)
+	}
+	return nil
+}
+
+//检查资产当前是否允许转让
+func checkAssetTransferable(stub shim.ChaincodeStubInterface, asset *Asset) error {
+	if err := checkAssetLease(stub, asset.ID); err != nil {
+		return err
+	}
+	return checkAssetPending(stub, asset.ID)
+}
+
+//检查资产是否处于锁定、哈希时间锁定或拍卖中，此时不能转让，也不能再出租
+func checkAssetPending(stub shim.ChaincodeStubInterface, assetID string) error {
+	if err := checkAssetLock(stub, assetID); err != nil {
+		return err
+	}
+	if htlc, err := getAssetHTLC(stub, assetID); err != nil {
+		return err
+	} else if htlc != nil && htlc.Status == htlcLocked {
+		return fmt.Errorf("asset is hash-time-locked for %s", htlc.ReceiverID)
+	}
+	auctionID, err := stub.GetState(constructAssetAuctionKey(assetID))
+	if err != nil {
+		return fmt.Errorf("query asset auction error %s", err)
+	}
+	if len(auctionID) != 0 {
+		return fmt.Errorf("asset is on auction %s", auctionID)
+	}
+	return nil
+}
+
+//检查资产是否有未结束的禁止转让租约
+func checkAssetLease(stub shim.ChaincodeStubInterface, assetID string) error {
+	leases, err := getAssetLeases(stub, assetID)
+	if err != nil {
+		return err
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+	for _, lease := range leases {
+		if lease.BlockTransfer && now.Unix() < lease.End {
+			return fmt.Errorf("asset %s is leased to %s until %s", assetID, lease.LesseeID,
+				time.Unix(lease.End, 0).UTC().Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+//查询资产全部租约，按开始时间排序
+func getAssetLeases(stub shim.ChaincodeStubInterface, assetID string) ([]*AssetLease, error) {
+	result, err := stub.GetStateByPartialCompositeKey("lease", []string{assetID})
+	if err != nil {
+		return nil, fmt.Errorf("query lease error %s", err)
+	}
+	defer result.Close()
+	leases := make([]*AssetLease, 0)
+	for result.HasNext() {
+		leaseVal, err := result.Next()
+		if err != nil {
+			return nil, fmt.Errorf("query error %s", err)
+		}
+		lease := new(AssetLease)
+		if err := json.Unmarshal(leaseVal.GetValue(), lease); err != nil {
+			return nil, fmt.Errorf("unmarshal lease error %s", err)
+		}
+		leases = append(leases, lease)
+	}
+	sort.SliceStable(leases, func(i, j int) bool {
+		return leases[i].Start < leases[j].Start
+	})
+	return leases, nil
+}
+
+//写入资产租约
+func putAssetLease(stub shim.ChaincodeStubInterface, lease *AssetLease) error {
+	leaseKey, err := stub.CreateCompositeKey("lease", []string{lease.AssetID, lease.ID})
+	if err != nil {
+		return fmt.Errorf("create key error %s", err)
+	}
+	leaseBytes, err := json.Marshal(lease)
+	if err != nil {
+		return fmt.Errorf("marshal lease error %s", err)
+	}
+	if err := stub.PutState(leaseKey, leaseBytes); err != nil {
+		return fmt.Errorf("save lease error %s", err)
+	}
+	return nil
+}
+
+//检查资产是否被监管冻结，已过期的冻结视为解除
+func checkAssetLock(stub shim.ChaincodeStubInterface, assetID string) error {
+	lock, err := getAssetLock(stub, assetID)
+	if err != nil || lock == nil {
+		return err
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+	if lock.ExpiresAt != 0 && now.Unix() >= lock.ExpiresAt {
+		return nil
+	}
+	if lock.ExpiresAt != 0 {
+		return fmt.Errorf("asset %s is locked by %s (%s) until %s", assetID, lock.LockedBy, lock.Reason,
+			time.Unix(lock.ExpiresAt, 0).UTC().Format(time.RFC3339))
+	}
+	return fmt.Errorf("asset %s is locked by %s (%s)", assetID, lock.LockedBy, lock.Reason)
+}
+
+//查询资产冻结记录，未冻结时返回nil
+func getAssetLock(stub shim.ChaincodeStubInterface, assetID string) (*AssetLock, error) {
+	lockBytes, err := stub.GetState(constructLockKey(assetID))
+	if err != nil {
+		return nil, fmt.Errorf("query asset lock error %s", err)
+	}
+	if len(lockBytes) == 0 {
+		return nil, nil
+	}
+	lock := new(AssetLock)
+	if err := json.Unmarshal(lockBytes, lock); err != nil {
+		return nil, fmt.Errorf("unmarshal asset lock error %s", err)
+	}
+	return lock, nil
+}
+
+//解析并校验版税规则，收款用户必须存在且总费率不超过100%
+func parseRoyalties(stub shim.ChaincodeStubInterface, royaltiesJSON string) ([]*RoyaltyRule, error) {
+	royalties := make([]*RoyaltyRule, 0)
+	if err := json.Unmarshal([]byte(royaltiesJSON), &royalties); err != nil {
+		return nil, fmt.Errorf("unmarshal royalties error %s", err)
+	}
+	var total int64
+	for _, rule := range royalties {
+		if rule.RecipientID == "" || rule.RateBps <= 0 {
+			return nil, fmt.Errorf("invalid royalty rule")
+		}
+		if _, err := getUser(stub, rule.RecipientID); err != nil {
+			return nil, err
+		}
+		total += rule.RateBps
+	}
+	if total > bpsDenominator {
+		return nil, fmt.Errorf("total royalty rate exceeds 100%%")
+	}
+	return royalties, nil
+}
+
+//按万分之一费率计算金额，向下取整
+func bpsAmount(price, rateBps int64) int64 {
+	return price/bpsDenominator*rateBps + price%bpsDenominator*rateBps/bpsDenominator
+}
+
+//计算有偿转让的分账（版税、平台手续费，剩余归卖方）并记录
+func settlePayment(stub shim.ChaincodeStubInterface, asset *Asset, sellerID, buyerID string, price int64) (*PaymentRecord, error) {
+	config, err := getConfig(stub)
+	if err != nil {
+		return nil, err
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return nil, err
+	}
+	record := &PaymentRecord{
+		AssetID:   asset.ID,
+		TxID:      stub.GetTxID(),
+		Timestamp: now.Unix(),
+		SellerID:  sellerID,
+		BuyerID:   buyerID,
+		Price:     price,
+		Splits:    make([]*PaymentSplit, 0),
+	}
+	remaining := price
+	if asset.Class != "" {
+		class, err := getAssetClass(stub, asset.Class)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range class.Royalties {
+			amount := bpsAmount(price, rule.RateBps)
+			record.Splits = append(record.Splits, &PaymentSplit{RecipientID: rule.RecipientID, Role: "royalty", Amount: amount})
+			remaining -= amount
+		}
+	}
+	if config.FeeAccount != "" && config.FeeRateBps > 0 {
+		amount := bpsAmount(price, config.FeeRateBps)
+		record.Splits = append(record.Splits, &PaymentSplit{RecipientID: config.FeeAccount, Role: "platform_fee", Amount: amount})
+		remaining -= amount
+	}
+	if remaining < 0 {
+		return nil, fmt.Errorf("royalties and fees exceed price")
+	}
+	record.Splits = append(record.Splits, &PaymentSplit{RecipientID: sellerID, Role: "seller", Amount: remaining})
+
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("marshal payment error %s", err)
+	}
+	paymentKey, err := stub.CreateCompositeKey("payment", []string{asset.ID, record.TxID})
+	if err != nil {
+		return nil, fmt.Errorf("create key error %s", err)
+	}
+	if err := stub.PutState(paymentKey, recordBytes); err != nil {
+		return nil, fmt.Errorf("save payment error %s", err)
+	}
+	return record, nil
+}
+
+//检查批量操作条数是否在配置的上限内
+func checkBatchSize(config *Config, size int) error {
+	maxSize := config.MaxBatchSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxBatchSize
+	}
+	if size == 0 || size > maxSize {
+		return fmt.Errorf("batch size must be between 1 and %d", maxSize)
+	}
+	return nil
+}
+
+//批量操作失败时整体拒绝交易，错误信息中携带逐项结果
+func batchFailure(results []*BatchItemResult) peer.Response {
+	resultsBytes, err := json.Marshal(results)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
+	}
+	return peer.Response{
+		Status:  shim.ERROR,
+		Message: fmt.Sprintf("batch rejected: %s", resultsBytes),
+		Payload: resultsBytes,
+	}
+}
+
+//整体转让资产，已拆分的资产要求转出方持有全部份额
+func transferWholeAsset(stub shim.ChaincodeStubInterface, asset *Asset, fromID, toID, operatorID string) error {
+	if asset.TotalShares > 0 {
+		share, err := getAssetShare(stub, asset.ID, fromID)
+		if err != nil {
+			return err
+		}
+		if share.Quantity != asset.TotalShares {
+			return fmt.Errorf("asset is co-owned, owner does not hold all shares")
+		}
+		if _, err := moveAssetShares(stub, asset, fromID, toID, share.Quantity); err != nil {
+			return err
+		}
+	}
+	return changeAssetOwner(stub, asset, fromID, toID, operatorID)
+}
+
+func getAuction(stub shim.ChaincodeStubInterface, auctionID string) (*Auction, error) {
+	auctionBytes, err := stub.GetState(constructAuctionKey(auctionID))
+	if err != nil || len(auctionBytes) == 0 {
+		return nil, fmt.Errorf("auction not found")
+	}
+	auction := new(Auction)
+	if err := json.Unmarshal(auctionBytes, auction); err != nil {
+		return nil, fmt.Errorf("unmarshal auction error %s", err)
+	}
+	return auction, nil
+}
+
+func putAuction(stub shim.ChaincodeStubInterface, auction *Auction) error {
+	auctionBytes, err := json.Marshal(auction)
+	if err != nil {
+		return fmt.Errorf("marshal auction error %s", err)
+	}
+	if err := stub.PutState(constructAuctionKey(auction.ID), auctionBytes); err != nil {
+		return fmt.Errorf("save auction error %s", err)
+	}
+	return nil
+}
+
+func putAuctionBid(stub shim.ChaincodeStubInterface, bidKey string, bid *AuctionBid) error {
+	bidBytes, err := json.Marshal(bid)
+	if err != nil {
+		return fmt.Errorf("marshal bid error %s", err)
+	}
+	if err := stub.PutState(bidKey, bidBytes); err != nil {
+		return fmt.Errorf("save bid error %s", err)
+	}
+	return nil
+}
+
+func getAuctionBids(stub shim.ChaincodeStubInterface, auctionID string) ([]*AuctionBid, error) {
+	result, err := stub.GetStateByPartialCompositeKey("auctionBid", []string{auctionID})
+	if err != nil {
+		return nil, fmt.Errorf("query bids error %s", err)
+	}
+	defer result.Close()
+	bids := make([]*AuctionBid, 0)
+	for result.HasNext() {
+		bidVal, err := result.Next()
+		if err != nil {
+			return nil, fmt.Errorf("query error %s", err)
+		}
+		bid := new(AuctionBid)
+		if err := json.Unmarshal(bidVal.GetValue(), bid); err != nil {
+			return nil, fmt.Errorf("unmarshal bid error %s", err)
+		}
+		bids = append(bids, bid)
+	}
+	sort.Slice(bids, func(i, j int) bool {
+		return bids[i].Timestamp < bids[j].Timestamp
+	})
+	return bids, nil
+}
+
+//计算出价承诺哈希，返回哈希及规范化后的出价内容
+func hashBid(bid *PrivateBid) (string, []byte, error) {
+	bidBytes, err := json.Marshal(bid)
+	if err != nil {
+		return "", nil, fmt.Errorf("marshal bid error %s", err)
+	}
+	sum := sha256.Sum256(bidBytes)
+	return hex.EncodeToString(sum[:]), bidBytes, nil
+}
+
+func constructApprovalKey(assetID string) string {
+	return fmt.Sprintf("approval_%s", assetID)
+}
+
+func constructOperatorKey(stub shim.ChaincodeStubInterface, ownerID, operatorID string) (string, error) {
+	return stub.CreateCompositeKey("operator", []string{ownerID, operatorID})
+}
+
+//检查操作员是否获得单个资产授权或拥有者的全部资产授权
+func isApprovedOperator(stub shim.ChaincodeStubInterface, ownerID, assetID, operatorID string) (bool, error) {
+	approvalBytes, err := stub.GetState(constructApprovalKey(assetID))
+	if err != nil {
+		return false, fmt.Errorf("query approval error %s", err)
+	}
+	if len(approvalBytes) != 0 {
+		approval := new(AssetApproval)
+		if err := json.Unmarshal(approvalBytes, approval); err != nil {
+			return false, fmt.Errorf("unmarshal approval error %s", err)
+		}
+		if approval.OwnerID == ownerID && approval.OperatorID == operatorID {
+			return true, nil
+		}
+	}
+	operatorKey, err := constructOperatorKey(stub, ownerID, operatorID)
+	if err != nil {
+		return false, fmt.Errorf("create key error %s", err)
+	}
+	operatorBytes, err := stub.GetState(operatorKey)
+	if err != nil {
+		return false, fmt.Errorf("query operator approval error %s", err)
+	}
+	return len(operatorBytes) != 0, nil
+}
+
+func constructShareKey(stub shim.ChaincodeStubInterface, assetID, holderID string) (string, error) {
+	return stub.CreateCompositeKey("share", []string{assetID, holderID})
+}
+
+func constructHolderIndexKey(stub shim.ChaincodeStubInterface, holderID, assetID string) (string, error) {
+	return stub.CreateCompositeKey("holder~asset", []string{holderID, assetID})
+}
+
+//查询用户持有的资产份额，未持有时返回数量为0的份额
+func getAssetShare(stub shim.ChaincodeStubInterface, assetID, holderID string) (*AssetShare, error) {
+	shareKey, err := constructShareKey(stub, assetID, holderID)
+	if err != nil {
+		return nil, fmt.Errorf("create key error %s", err)
+	}
+	shareBytes, err := stub.GetState(shareKey)
+	if err != nil {
+		return nil, fmt.Errorf("query share error %s", err)
+	}
+	share := &AssetShare{AssetID: assetID, HolderID: holderID}
+	if len(shareBytes) == 0 {
+		return share, nil
+	}
+	if err := json.Unmarshal(shareBytes, share); err != nil {
+		return nil, fmt.Errorf("unmarshal share error %s", err)
+	}
+	return share, nil
+}
+
+//保存份额及持有人索引，数量为0时删除
+func putAssetShare(stub shim.ChaincodeStubInterface, share *AssetShare) error {
+	shareKey, err := constructShareKey(stub, share.AssetID, share.HolderID)
+	if err != nil {
+		return fmt.Errorf("create key error %s", err)
+	}
+	indexKey, err := constructHolderIndexKey(stub, share.HolderID, share.AssetID)
+	if err != nil {
+		return fmt.Errorf("create key error %s", err)
+	}
+	if share.Quantity == 0 {
+		if err := stub.DelState(shareKey); err != nil {
+			return fmt.Errorf("delete share error %s", err)
+		}
+		if err := stub.DelState(indexKey); err != nil {
+			return fmt.Errorf("delete share index error %s", err)
+		}
+		return nil
+	}
+	shareBytes, err := json.Marshal(share)
+	if err != nil {
+		return fmt.Errorf("marshal share error %s", err)
+	}
+	if err := stub.PutState(shareKey, shareBytes); err != nil {
+		return fmt.Errorf("save share error %s", err)
+	}
+	if err := stub.PutState(indexKey, []byte{0x00}); err != nil {
+		return fmt.Errorf("save share index error %s", err)
+	}
+	return nil
+}
+
+//在两个持有人之间转移份额，返回接收方转移后的份额
+func moveAssetShares(stub shim.ChaincodeStubInterface, asset *Asset, fromID, toID string, quantity int64) (*AssetShare, error) {
+	fromShare, err := getAssetShare(stub, asset.ID, fromID)
+	if err != nil {
+		return nil, err
+	}
+	if fromShare.Quantity < quantity {
+		return nil, fmt.Errorf("insufficient shares: hold %d, transfer %d", fromShare.Quantity, quantity)
+	}
+	toShare, err := getAssetShare(stub, asset.ID, toID)
+	if err != nil {
+		return nil, err
+	}
+	fromShare.Quantity -= quantity
+	toShare.Quantity += quantity
+	if err := putAssetShare(stub, fromShare); err != nil {
+		return nil, err
+	}
+	if err := putAssetShare(stub, toShare); err != nil {
+		return nil, err
+	}
+	return toShare, nil
+}
+
+//按JSON Schema子集校验数据，支持type、enum、properties、required、additionalProperties、
+//items、minItems/maxItems、minLength/maxLength、pattern、minimum/maximum
+//属性按名称排序遍历，保证各背书节点返回的错误信息一致
+func validateJSONSchema(schema map[string]interface{}, value interface{}, path string) error {
+	if t, ok := schema["type"]; ok {
+		types := make([]string, 0)
+		switch tv := t.(type) {
+		case string:
+			types = append(types, tv)
+		case []interface{}:
+			for _, item := range tv {
+				if name, ok := item.(string); ok {
+					types = append(types, name)
+				}
+			}
+		default:
+			return fmt.Errorf("%s: invalid schema type", path)
+		}
+		matched := false
+		for _, name := range types {
+			if jsonTypeMatches(name, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: expected type %v", path, types)
+		}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		matched := false
+		for _, candidate := range enum {
+			if reflect.DeepEqual(candidate, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: value not in enum", path)
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if min, ok := schema["minLength"].(float64); ok && length < min {
+			return fmt.Errorf("%s: shorter than minLength %v", path, min)
+		}
+		if max, ok := schema["maxLength"].(float64); ok && length > max {
+			return fmt.Errorf("%s: longer than maxLength %v", path, max)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("%s: invalid pattern %s", path, err)
+			}
+			if !re.MatchString(v) {
+				return fmt.Errorf("%s: does not match pattern %s", path, pattern)
+			}
+		}
+	case float64:
+		if min, ok := schema["minimum"].(float64); ok && v < min {
+			return fmt.Errorf("%s: less than minimum %v", path, min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && v > max {
+			return fmt.Errorf("%s: greater than maximum %v", path, max)
+		}
+	case []interface{}:
+		if min, ok := schema["minItems"].(float64); ok && float64(len(v)) < min {
+			return fmt.Errorf("%s: fewer than minItems %v", path, min)
+		}
+		if max, ok := schema["maxItems"].(float64); ok && float64(len(v)) > max {
+			return fmt.Errorf("%s: more than maxItems %v", path, max)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validateJSONSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if key, ok := name.(string); ok {
+					if _, exist := v[key]; !exist {
+						return fmt.Errorf("%s: missing required property %s", path, key)
+					}
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			propSchema, ok := properties[key].(map[string]interface{})
+			if !ok {
+				if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+					return fmt.Errorf("%s: additional property %s not allowed", path, key)
+				}
+				continue
+			}
+			if err := validateJSONSchema(propSchema, v[key], path+"."+key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func jsonTypeMatches(name string, value interface{}) bool {
+	switch name {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "null":
+		return value == nil
+	}
+	return false
+}
+
+//用户注册（开户）
+func userRegister(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 2 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	name := args[0]
+	id := args[1]
+	if name == "" || id == "" {
+		return shim.Error("Invalid args")
+	}
+	//step3:验证数据是否存在
+	if userBytes, err := stub.GetState(constructUserKey(id)); err != nil || len(userBytes) != 0 {
+		return shim.Error("User already exist")
+	}
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("get msp id error %s", err))
+	}
+	//step4:写入状态
+	user := User{Name: name, ID: id, MSPID: mspID}
+	//序列化对象
+	userBytes, err := json.Marshal(user)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal user error %s", err))
+	}
+	err = stub.PutState(constructUserKey(id), userBytes)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("put user error %s", err))
+	}
+	return shim.Success(nil)
+}
+
+//资产登记，可选的第5个参数为资产类别
+func assetEnroll(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 4 && len(args) != 5 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	req := &EnrollRequest{Name: args[0], ID: args[1], Metadata: args[2], OwnerID: args[3]}
+	if len(args) == 5 {
+		req.Class = args[4]
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//step3:验证数据是否存在
+	if err := validateEnroll(stub, config, req); err != nil {
+		return shim.Error(err.Error())
+	}
+	//step4:写入状态
+	historyBytes, err := applyEnroll(stub, req)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(historyBytes)
+}
+
+//校验资产登记请求
+func validateEnroll(stub shim.ChaincodeStubInterface, config *Config, req *EnrollRequest) error {
+	if req.Name == "" || req.ID == "" || req.OwnerID == "" {
+		return fmt.Errorf("Invalid args")
+	}
+	if err := validateAssetMetadata(stub, req.Class, req.Metadata); err != nil {
+		return err
+	}
+	if userBytes, err := stub.GetState(constructUserKey(req.OwnerID)); err != nil || len(userBytes) == 0 {
+		return fmt.Errorf("User not found")
+	}
+	if assetBytes, err := stub.GetState(constructAssetKey(req.ID)); err != nil || len(assetBytes) != 0 {
+		return fmt.Errorf("Asset already exist")
+	}
+	if config.UniqueNames {
+		if exist, err := assetNameExists(stub, req.Name); err != nil {
+			return err
+		} else if exist {
+			return fmt.Errorf("Asset name already exist")
+		}
+	}
+	if tombstone, err := getAssetTombstone(stub, req.ID); err != nil {
+		return err
+	} else if tombstone != nil {
+		return fmt.Errorf("Asset retired, id can not be reused")
+	}
+	return nil
+}
+
+//写入已校验的资产登记请求，返回资产变更记录
+func applyEnroll(stub shim.ChaincodeStubInterface, req *EnrollRequest) ([]byte, error) {
+	asset := &Asset{Name: req.Name, ID: req.ID, Metadata: req.Metadata, Owner: req.OwnerID, Class: req.Class, MetadataVer: 1}
+	if err := putAsset(stub, asset); err != nil {
+		return nil, err
+	}
+	if err := putOwnerIndex(stub, req.OwnerID, req.ID); err != nil {
+		return nil, err
+	}
+	if err := updateAssetIndexes(stub, asset, false); err != nil {
+		return nil, err
+	}
+	if err := setAssetEndorsementPolicy(stub, req.ID, req.OwnerID); err != nil {
+		return nil, err
+	}
+	//资产变更历史
+	return putAssetHistory(stub, req.ID, originOwner, req.OwnerID, "")
+}
+
+//资产转让，可选的第4个参数为代为转让的操作员
+func assetExchange(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 3 && len(args) != 4 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	req := &TransferRequest{OwnerID: args[0], AssetID: args[1], NewOwnerID: args[2]}
+	if len(args) == 4 {
+		req.OperatorID = args[3]
+	}
+	//step3:验证数据是否存在
+	asset, err := validateTransfer(stub, req)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//step4:写入状态
+	if err := transferWholeAsset(stub, asset, req.OwnerID, req.NewOwnerID, req.OperatorID); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+//资产有偿转让，成交价按类别版税和平台手续费分账，可选的第5个参数为代为转让的操作员
+func assetSale(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 4 && len(args) != 5 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	req := &TransferRequest{OwnerID: args[0], AssetID: args[1], NewOwnerID: args[2]}
+	price, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil || price <= 0 {
+		return shim.Error("Invalid args")
+	}
+	if len(args) == 5 {
+		req.OperatorID = args[4]
+	}
+	//step3:验证数据是否存在
+	asset, err := validateTransfer(stub, req)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//step4:写入状态
+	record, err := settlePayment(stub, asset, req.OwnerID, req.NewOwnerID, price)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := transferWholeAsset(stub, asset, req.OwnerID, req.NewOwnerID, req.OperatorID); err != nil {
+		return shim.Error(err.Error())
+	}
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
+	}
+	return shim.Success(recordBytes)
+}
+
+//校验资产转让请求，返回待转让的资产
+func validateTransfer(stub shim.ChaincodeStubInterface, req *TransferRequest) (*Asset, error) {
+	if req.OwnerID == "" || req.AssetID == "" || req.NewOwnerID == "" {
+		return nil, fmt.Errorf("Invalid args")
+	}
+	if req.OperatorID == req.OwnerID {
+		req.OperatorID = ""
+	}
+	if _, err := getUser(stub, req.OwnerID); err != nil {
+		return nil, err
+	}
+	if _, err := getUser(stub, req.NewOwnerID); err != nil {
+		return nil, err
+	}
+	asset, err := getAsset(stub, req.AssetID)
+	if err != nil {
+		return nil, err
+	}
+	//校验原始拥有着确实拥有当前变更的资产
+	if owned, err := ownsAsset(stub, req.OwnerID, req.AssetID); err != nil {
+		return nil, err
+	} else if !owned {
+		return nil, fmt.Errorf("asset owner not match")
+	}
+	//调用者须为拥有者本人，或为获得授权的操作员
+	if req.OperatorID != "" {
+		if approved, err := isApprovedOperator(stub, req.OwnerID, req.AssetID, req.OperatorID); err != nil {
+			return nil, err
+		} else if !approved {
+			return nil, fmt.Errorf("operator not approved")
+		}
+		if err := checkCallerIsUser(stub, req.OperatorID); err != nil {
+			return nil, err
+		}
+	} else if err := checkCallerIsUser(stub, req.OwnerID); err != nil {
+		return nil, err
+	}
+	if err := checkAssetTransferable(stub, asset); err != nil {
+		return nil, err
+	}
+	//已拆分的资产要求转出方持有全部份额
+	if asset.TotalShares > 0 {
+		share, err := getAssetShare(stub, asset.ID, req.OwnerID)
+		if err != nil {
+			return nil, err
+		}
+		if share.Quantity != asset.TotalShares {
+			return nil, fmt.Errorf("asset is co-owned, owner does not hold all shares")
+		}
+	}
+	return asset, nil
+}
+
+//批量资产登记，参数为EnrollRequest的JSON数组；全部校验通过后在同一交易内写入
+func batchEnroll(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	reqs := make([]*EnrollRequest, 0)
+	if err := json.Unmarshal([]byte(args[0]), &reqs); err != nil {
+		return shim.Error(fmt.Sprintf("unmarshal batch error %s", err))
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkBatchSize(config, len(reqs)); err != nil {
+		return shim.Error(err.Error())
+	}
+	//step3:逐项校验，同一批次内的资产ID（及开启唯一约束时的名称）不能重复
+	results := make([]*BatchItemResult, len(reqs))
+	ids := make(map[string]bool)
+	names := make(map[string]bool)
+	failed := false
+	for i, req := range reqs {
+		results[i] = &BatchItemResult{Index: i, ID: req.ID, Success: true}
+		err := validateEnroll(stub, config, req)
+		if err == nil && ids[req.ID] {
+			err = fmt.Errorf("duplicate asset id in batch")
+		}
+		if err == nil && config.UniqueNames && names[req.Name] {
+			err = fmt.Errorf("duplicate asset name in batch")
+		}
+		ids[req.ID] = true
+		names[req.Name] = true
+		if err != nil {
+			results[i].Success = false
+			results[i].Error = err.Error()
+			failed = true
+		}
+	}
+	if failed {
+		return batchFailure(results)
+	}
+	//step4:写入状态
+	for i, req := range reqs {
+		if _, err := applyEnroll(stub, req); err != nil {
+			results[i].Success = false
+			results[i].Error = err.Error()
+			return batchFailure(results)
+		}
+	}
+	resultsBytes, err := json.Marshal(results)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
+	}
+	return shim.Success(resultsBytes)
+}
+
+//批量资产转让，参数为TransferRequest的JSON数组；全部校验通过后在同一交易内写入
+func batchTransfer(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	reqs := make([]*TransferRequest, 0)
+	if err := json.Unmarshal([]byte(args[0]), &reqs); err != nil {
+		return shim.Error(fmt.Sprintf("unmarshal batch error %s", err))
+	}
+	config, err := getConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkBatchSize(config, len(reqs)); err != nil {
+		return shim.Error(err.Error())
+	}
+	//step3:逐项校验，同一资产在一个批次内只能转让一次
+	results := make([]*BatchItemResult, len(reqs))
+	assets := make([]*Asset, len(reqs))
+	seen := make(map[string]bool)
+	failed := false
+	for i, req := range reqs {
+		results[i] = &BatchItemResult{Index: i, ID: req.AssetID, Success: true}
+		asset, err := validateTransfer(stub, req)
+		if err == nil && seen[req.AssetID] {
+			err = fmt.Errorf("asset transferred more than once in batch")
+		}
+		seen[req.AssetID] = true
+		if err != nil {
+			results[i].Success = false
+			results[i].Error = err.Error()
+			failed = true
+		}
+		assets[i] = asset
+	}
+	if failed {
+		return batchFailure(results)
+	}
+	//step4:写入状态
+	for i, req := range reqs {
+		if err := transferWholeAsset(stub, assets[i], req.OwnerID, req.NewOwnerID, req.OperatorID); err != nil {
+			results[i].Success = false
+			results[i].Error = err.Error()
+			return batchFailure(results)
+		}
+	}
+	resultsBytes, err := json.Marshal(results)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
+	}
+	return shim.Success(resultsBytes)
+}
+
+//登记资产类别，仅管理组织可调用，可选的第4个参数为版税规则JSON数组
+func registerAssetClass(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 3 && len(args) != 4 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	classID := args[0]
+	name := args[1]
+	schemaJSON := args[2]
+	if classID == "" || name == "" {
+		return shim.Error("Invalid args")
+	}
+	schema := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(schemaJSON), &schema); err != nil {
+		return shim.Error(fmt.Sprintf("schema is not a json object %s", err))
+	}
+	mspID, err := checkAdmin(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//step3:验证数据是否存在
+	if classBytes, err := stub.GetState(constructAssetClassKey(classID)); err != nil || len(classBytes) != 0 {
+		return shim.Error("Asset class already exist")
+	}
+	var royalties []*RoyaltyRule
+	if len(args) == 4 {
+		if royalties, err = parseRoyalties(stub, args[3]); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	//step4:写入状态
+	class := &AssetClass{ID: classID, Name: name, Schema: json.RawMessage(schemaJSON), CreatedBy: mspID, Royalties: royalties}
+	classBytes, err := json.Marshal(class)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal asset class error %s", err))
+	}
+	if err := stub.PutState(constructAssetClassKey(classID), classBytes); err != nil {
+		return shim.Error(fmt.Sprintf("save asset class error %s", err))
+	}
+	return shim.Success(nil)
+}
+
+//设置资产类别的版税规则，仅管理组织可调用
+func setAssetClassRoyalties(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 2 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	classID := args[0]
+	if classID == "" {
+		return shim.Error("Invalid args")
+	}
+	if _, err := checkAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	royalties, err := parseRoyalties(stub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//step3:验证数据是否存在
+	class, err := getAssetClass(stub, classID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//step4:写入状态
+	class.Royalties = royalties
+	classBytes, err := json.Marshal(class)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal asset class error %s", err))
+	}
+	if err := stub.PutState(constructAssetClassKey(classID), classBytes); err != nil {
+		return shim.Error(fmt.Sprintf("save asset class error %s", err))
+	}
+	return shim.Success(nil)
+}
+
+//更新资产元数据，旧版本保留在metadata~assetID~version下
+func updateAssetMetadata(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 3 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	ownerID := args[0]
+	assetID := args[1]
+	metadata := args[2]
+	if ownerID == "" || assetID == "" {
+		return shim.Error("Invalid args")
+	}
+	//step3:验证数据是否存在
+	asset, err := getAsset(stub, assetID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if owned, err := ownsAsset(stub, ownerID, assetID); err != nil {
+		return shim.Error(err.Error())
+	} else if !owned {
+		return shim.Error("asset owner not match")
+	}
+	if err := validateAssetMetadata(stub, asset.Class, metadata); err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//step4:写入状态，旧版本资产没有版本号时视为第1版
+	if asset.MetadataVer == 0 {
+		asset.MetadataVer = 1
+	}
+	previous := &AssetMetadataVersion{
+		AssetID:      assetID,
+		Version:      asset.MetadataVer,
+		Metadata:     asset.Metadata,
+		SupersededBy: stub.GetTxID(),
+		SupersededAt: now.Unix(),
+	}
+	previousBytes, err := json.Marshal(previous)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal metadata error %s", err))
+	}
+	versionKey, err := stub.CreateCompositeKey("metadata", []string{assetID, fmt.Sprintf("%020d", previous.Version)})
+	if err != nil {
+		return shim.Error(fmt.Sprintf("create key error %s", err))
+	}
+	if err := stub.PutState(versionKey, previousBytes); err != nil {
+		return shim.Error(fmt.Sprintf("save metadata version error %s", err))
+	}
+	asset.Metadata = metadata
+	asset.MetadataVer++
+	if err := putAsset(stub, asset); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+//授权操作员代为转让单个资产，操作员为空时撤销授权
+func approve(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 3 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	ownerID := args[0]
+	assetID := args[1]
+	operatorID := args[2]
+	if ownerID == "" || assetID == "" || operatorID == ownerID {
+		return shim.Error("Invalid args")
+	}
+	//step3:验证数据是否存在
+	if _, err := getAsset(stub, assetID); err != nil {
+		return shim.Error(err.Error())
+	}
+	if owned, err := ownsAsset(stub, ownerID, assetID); err != nil {
+		return shim.Error(err.Error())
+	} else if !owned {
+		return shim.Error("asset owner not match")
+	}
+	if err := checkCallerIsUser(stub, ownerID); err != nil {
+		return shim.Error(err.Error())
+	}
+	//step4:写入状态
+	if operatorID == "" {
+		if err := stub.DelState(constructApprovalKey(assetID)); err != nil {
+			return shim.Error(fmt.Sprintf("delete approval error %s", err))
+		}
+		return shim.Success(nil)
+	}
+	if _, err := getUser(stub, operatorID); err != nil {
+		return shim.Error(err.Error())
+	}
+	approval := &AssetApproval{AssetID: assetID, OwnerID: ownerID, OperatorID: operatorID}
+	approvalBytes, err := json.Marshal(approval)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal approval error %s", err))
+	}
+	if err := stub.PutState(constructApprovalKey(assetID), approvalBytes); err != nil {
+		return shim.Error(fmt.Sprintf("save approval error %s", err))
+	}
+	return shim.Success(nil)
+}
+
+//授权或撤销操作员代为转让用户的全部资产
+func setApprovalForAll(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 3 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	ownerID := args[0]
+	operatorID := args[1]
+	approved, err := strconv.ParseBool(args[2])
+	if ownerID == "" || operatorID == "" || ownerID == operatorID || err != nil {
+		return shim.Error("Invalid args")
+	}
+	//step3:验证数据是否存在
+	if err := checkCallerIsUser(stub, ownerID); err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, err := getUser(stub, operatorID); err != nil {
+		return shim.Error(err.Error())
+	}
+	//step4:写入状态
+	operatorKey, err := constructOperatorKey(stub, ownerID, operatorID)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("create key error %s", err))
+	}
+	if !approved {
+		if err := stub.DelState(operatorKey); err != nil {
+			return shim.Error(fmt.Sprintf("delete operator approval error %s", err))
+		}
+		return shim.Success(nil)
+	}
+	if err := stub.PutState(operatorKey, []byte{0x00}); err != nil {
+		return shim.Error(fmt.Sprintf("save operator approval error %s", err))
+	}
+	return shim.Success(nil)
+}
+
+//监管冻结资产，可选的到期时间为RFC3339格式
+func lockAsset(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	assetID := args[0]
+	reason := args[1]
+	if assetID == "" || !lockReasons[reason] {
+		return shim.Error("Invalid args")
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var expiresAt int64
+	if len(args) == 3 && args[2] != "" {
+		expiry, err := time.Parse(time.RFC3339, args[2])
+		if err != nil {
+			return shim.Error(fmt.Sprintf("invalid expiry %s", err))
+		}
+		if !expiry.After(now) {
+			return shim.Error("expiry must be in the future")
+		}
+		expiresAt = expiry.Unix()
+	}
+	mspID, err := checkRegulator(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//step3:验证数据是否存在
+	if _, err := getAsset(stub, assetID); err != nil {
+		return shim.Error(err.Error())
+	}
+	//step4:写入状态
+	lock := &AssetLock{AssetID: assetID, Reason: reason, LockedBy: mspID, LockedAt: now.Unix(), ExpiresAt: expiresAt}
+	lockBytes, err := json.Marshal(lock)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal asset lock error %s", err))
+	}
+	if err := stub.PutState(constructLockKey(assetID), lockBytes); err != nil {
+		return shim.Error(fmt.Sprintf("save asset lock error %s", err))
+	}
+	return shim.Success(lockBytes)
+}
+
+//监管解冻资产
+func unlockAsset(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	assetID := args[0]
+	if assetID == "" {
+		return shim.Error("Invalid args")
+	}
+	if _, err := checkRegulator(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	//step3:验证数据是否存在
+	if lock, err := getAssetLock(stub, assetID); err != nil {
+		return shim.Error(err.Error())
+	} else if lock == nil {
+		return shim.Error("asset is not locked")
+	}
+	//step4:写入状态
+	if err := stub.DelState(constructLockKey(assetID)); err != nil {
+		return shim.Error(fmt.Sprintf("delete asset lock error %s", err))
+	}
+	return shim.Success(nil)
+}
+
+//出租资产：拥有者授予承租人在租期内的使用权，mode为block时租约结束前禁止转让，为carry时租约随资产转移
+func grantLease(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 7 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	ownerID := args[0]
+	assetID := args[1]
+	leaseID := args[2]
+	lesseeID := args[3]
+	mode := args[6]
+	if ownerID == "" || assetID == "" || leaseID == "" || lesseeID == "" || lesseeID == ownerID {
+		return shim.Error("Invalid args")
+	}
+	if mode != "block" && mode != "carry" {
+		return shim.Error("Invalid args")
+	}
+	start, err := time.Parse(time.RFC3339, args[4])
+	if err != nil {
+		return shim.Error(fmt.Sprintf("invalid start %s", err))
+	}
+	end, err := time.Parse(time.RFC3339, args[5])
+	if err != nil {
+		return shim.Error(fmt.Sprintf("invalid end %s", err))
+	}
+	if !end.After(start) {
+		return shim.Error("end must be after start")
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !end.After(now) {
+		return shim.Error("end must be in the future")
+	}
+	//step3:验证数据是否存在
+	asset, err := getAsset(stub, assetID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if owned, err := ownsAsset(stub, ownerID, assetID); err != nil {
+		return shim.Error(err.Error())
+	} else if !owned {
+		return shim.Error("asset owner not match")
+	}
+	if asset.TotalShares > 0 {
+		share, err := getAssetShare(stub, assetID, ownerID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if share.Quantity != asset.TotalShares {
+			return shim.Error("asset is co-owned, owner does not hold all shares")
+		}
+	}
+	if _, err := getUser(stub, lesseeID); err != nil {
+		return shim.Error(err.Error())
+	}
+	//交换或拍卖成交时资产将转给对方，不能再设置禁止转让的租约
+	if err := checkAssetPending(stub, assetID); err != nil {
+		return shim.Error(err.Error())
+	}
+	leases, err := getAssetLeases(stub, assetID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, lease := range leases {
+		if lease.ID == leaseID {
+			return shim.Error("Lease already exist")
+		}
+		if start.Unix() < lease.End && lease.Start < end.Unix() {
+			return shim.Error(fmt.Sprintf("lease overlaps with lease %s", lease.ID))
+		}
+	}
+	//step4:写入状态
+	lease := &AssetLease{
+		ID:            leaseID,
+		AssetID:       assetID,
+		LessorID:      ownerID,
+		LesseeID:      lesseeID,
+		Start:         start.Unix(),
+		End:           end.Unix(),
+		BlockTransfer: mode == "block",
+		GrantedAt:     now.Unix(),
+	}
+	if err := putAssetLease(stub, lease); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+//提前终止租约，可由当前拥有者或承租人发起；尚未开始的租约直接删除
+func terminateLease(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 3 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	userID := args[0]
+	assetID := args[1]
+	leaseID := args[2]
+	if userID == "" || assetID == "" || leaseID == "" {
+		return shim.Error("Invalid args")
+	}
+	//step3:验证数据是否存在
+	asset, err := getAsset(stub, assetID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	leaseKey, err := stub.CreateCompositeKey("lease", []string{assetID, leaseID})
+	if err != nil {
+		return shim.Error(fmt.Sprintf("create key error %s", err))
+	}
+	leaseBytes, err := stub.GetState(leaseKey)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("query lease error %s", err))
+	}
+	if len(leaseBytes) == 0 {
+		return shim.Error("Lease not found")
+	}
+	lease := new(AssetLease)
+	if err := json.Unmarshal(leaseBytes, lease); err != nil {
+		return shim.Error(fmt.Sprintf("unmarshal lease error %s", err))
+	}
+	if userID != asset.Owner && userID != lease.LesseeID {
+		return shim.Error("only the owner or lessee can terminate the lease")
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if now.Unix() >= lease.End {
+		return shim.Error("lease already ended")
+	}
+	//step4:写入状态
+	if now.Unix() < lease.Start {
+		if err := stub.DelState(leaseKey); err != nil {
+			return shim.Error(fmt.Sprintf("delete lease error %s", err))
+		}
+		return shim.Success(nil)
+	}
+	lease.End = now.Unix()
+	lease.TerminatedAt = now.Unix()
+	if err := putAssetLease(stub, lease); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+//哈希时间锁定资产：超时前接收方出示sha256原像即可取得资产，用于与其他通道或账本的原子交换
+func lockAssetHTLC(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 5 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	req := &TransferRequest{OwnerID: args[0], AssetID: args[1], NewOwnerID: args[2]}
+	hashLock := strings.ToLower(args[3])
+	if hash, err := hex.DecodeString(hashLock); err != nil || len(hash) != sha256.Size {
+		return shim.Error("invalid hash lock, expecting hex encoded sha256")
+	}
+	timeout, err := time.Parse(time.RFC3339, args[4])
+	if err != nil {
+		return shim.Error(fmt.Sprintf("invalid timeout %s", err))
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !timeout.After(now) {
+		return shim.Error("timeout must be in the future")
+	}
+	//step3:验证数据是否存在
+	if _, err := validateTransfer(stub, req); err != nil {
+		return shim.Error(err.Error())
+	}
+	//step4:写入状态
+	htlc := &AssetHTLC{
+		AssetID:    req.AssetID,
+		SenderID:   req.OwnerID,
+		ReceiverID: req.NewOwnerID,
+		HashLock:   hashLock,
+		Timeout:    timeout.Unix(),
+		Status:     htlcLocked,
+		LockedAt:   now.Unix(),
+		TxID:       stub.GetTxID(),
+	}
+	htlcBytes, err := putAssetHTLC(stub, htlc)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := setAssetHTLCEndorsementPolicy(stub, htlc.AssetID, htlc.SenderID, htlc.ReceiverID); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(htlcBytes)
+}
+
+//出示原像领取哈希时间锁定的资产，须在超时前
+func claimAssetHTLC(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 2 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	assetID := args[0]
+	preimage := args[1]
+	if assetID == "" || preimage == "" {
+		return shim.Error("Invalid args")
+	}
+	//step3:验证数据是否存在
+	htlc, err := getAssetHTLC(stub, assetID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if htlc == nil || htlc.Status != htlcLocked {
+		return shim.Error("asset is not hash-time-locked")
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if now.Unix() >= htlc.Timeout {
+		return shim.Error("htlc expired")
+	}
+	sum := sha256.Sum256([]byte(preimage))
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), htlc.HashLock) {
+		return shim.Error("preimage does not match hash lock")
+	}
+	if err := checkAssetLock(stub, assetID); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkAssetLease(stub, assetID); err != nil {
+		return shim.Error(err.Error())
+	}
+	asset, err := getAsset(stub, assetID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//step4:写入状态
+	if err := transferWholeAsset(stub, asset, htlc.SenderID, htlc.ReceiverID, ""); err != nil {
+		return shim.Error(err.Error())
+	}
+	htlc.Status = htlcClaimed
+	htlc.Preimage = preimage
+	htlc.SettledAt = now.Unix()
+	htlcBytes, err := putAssetHTLC(stub, htlc)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(htlcBytes)
+}
+
+//哈希时间锁超时后解除锁定，资产仍归发送方
+func refundAssetHTLC(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	assetID := args[0]
+	if assetID == "" {
+		return shim.Error("Invalid args")
+	}
+	//step3:验证数据是否存在
+	htlc, err := getAssetHTLC(stub, assetID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if htlc == nil || htlc.Status != htlcLocked {
+		return shim.Error("asset is not hash-time-locked")
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if now.Unix() < htlc.Timeout {
+		return shim.Error("htlc not expired")
+	}
+	//step4:写入状态
+	htlc.Status = htlcRefunded
+	htlc.SettledAt = now.Unix()
+	htlcBytes, err := putAssetHTLC(stub, htlc)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//恢复为仅由发送方组织背书
+	if err := setAssetEndorsementPolicy(stub, htlc.AssetID, htlc.SenderID); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(htlcBytes)
+}
+
+//注销资产：从拥有者名下移除并删除资产，保留注销记录，变更记录仍可查询
+func retireAsset(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 3 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	ownerID := args[0]
+	assetID := args[1]
+	reason := args[2]
+	if ownerID == "" || assetID == "" || reason == "" {
+		return shim.Error("Invalid args")
+	}
+	//step3:验证数据是否存在
+	asset, err := getAsset(stub, assetID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if owned, err := ownsAsset(stub, ownerID, assetID); err != nil {
+		return shim.Error(err.Error())
+	} else if !owned {
+		return shim.Error("asset owner not match")
+	}
+	if err := checkAssetTransferable(stub, asset); err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//随资产转移的租约未结束时同样不能注销
+	leases, err := getAssetLeases(stub, assetID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, lease := range leases {
+		if now.Unix() < lease.End {
+			return shim.Error(fmt.Sprintf("asset is leased to %s", lease.LesseeID))
+		}
+	}
+	if asset.TotalShares > 0 {
+		share, err := getAssetShare(stub, assetID, ownerID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if share.Quantity != asset.TotalShares {
+			return shim.Error("asset is co-owned, owner does not hold all shares")
+		}
+		share.Quantity = 0
+		if err := putAssetShare(stub, share); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	//step4:写入状态
+	tombstone := &AssetTombstone{
+		Asset:     asset,
+		OwnerID:   ownerID,
+		Reason:    reason,
+		RetiredAt: now.Unix(),
+		TxID:      stub.GetTxID(),
+	}
+	tombstoneBytes, err := json.Marshal(tombstone)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal tombstone error %s", err))
+	}
+	if err := stub.PutState(constructTombstoneKey(assetID), tombstoneBytes); err != nil {
+		return shim.Error(fmt.Sprintf("save tombstone error %s", err))
+	}
+	if err := delOwnerIndex(stub, ownerID, assetID); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := updateAssetIndexes(stub, asset, true); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := stub.DelState(constructApprovalKey(assetID)); err != nil {
+		return shim.Error(fmt.Sprintf("delete approval error %s", err))
+	}
+	if err := stub.DelState(constructAssetKey(assetID)); err != nil {
+		return shim.Error(fmt.Sprintf("delete asset error %s", err))
+	}
+	if _, err := putAssetHistory(stub, assetID, ownerID, retiredOwner, ""); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(tombstoneBytes)
+}
+
+//资产拆分为份额
+func assetSplit(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 3 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	ownerID := args[0]
+	assetID := args[1]
+	totalShares, err := strconv.ParseInt(args[2], 10, 64)
+	if ownerID == "" || assetID == "" || err != nil || totalShares <= 0 {
+		return shim.Error("Invalid args")
+	}
+	//step3:验证数据是否存在
+	if _, err := getUser(stub, ownerID); err != nil {
+		return shim.Error(err.Error())
+	}
+	asset, err := getAsset(stub, assetID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if owned, err := ownsAsset(stub, ownerID, assetID); err != nil {
+		return shim.Error(err.Error())
+	} else if !owned {
+		return shim.Error("asset owner not match")
+	}
+	if asset.TotalShares > 0 {
+		return shim.Error("asset already split")
+	}
+	if err := checkAssetTransferable(stub, asset); err != nil {
+		return shim.Error(err.Error())
+	}
+	//step4:写入状态，拥有者初始持有全部份额
+	asset.Owner = ownerID
+	asset.TotalShares = totalShares
+	if err := putAsset(stub, asset); err != nil {
+		return shim.Error(err.Error())
+	}
+	share := &AssetShare{AssetID: assetID, HolderID: ownerID, Quantity: totalShares}
+	if err := putAssetShare(stub, share); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+//资产份额转让
+func shareTransfer(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 4 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	fromID := args[0]
+	assetID := args[1]
+	toID := args[2]
+	quantity, err := strconv.ParseInt(args[3], 10, 64)
+	if fromID == "" || assetID == "" || toID == "" || err != nil || quantity <= 0 || fromID == toID {
+		return shim.Error("Invalid args")
+	}
+	//step3:验证数据是否存在
+	if _, err := getUser(stub, fromID); err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, err := getUser(stub, toID); err != nil {
+		return shim.Error(err.Error())
+	}
+	asset, err := getAsset(stub, assetID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if asset.TotalShares == 0 {
+		return shim.Error("asset is not split into shares")
+	}
+	if err := checkAssetTransferable(stub, asset); err != nil {
+		return shim.Error(err.Error())
+	}
+	//step4:写入状态
+	toShare, err := moveAssetShares(stub, asset, fromID, toID, quantity)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//接收方持有全部份额时，资产整体登记到其名下
+	if toShare.Quantity == asset.TotalShares && asset.Owner != toID {
+		if err := changeAssetOwner(stub, asset, asset.Owner, toID, ""); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	return shim.Success(nil)
+}
+
+//创建密封竞价拍卖
+func createAuction(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 5 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	auctionID := args[0]
+	sellerID := args[1]
+	assetID := args[2]
+	if auctionID == "" || sellerID == "" || assetID == "" {
+		return shim.Error("Invalid args")
+	}
+	bidDeadline, err := time.Parse(time.RFC3339, args[3])
+	if err != nil {
+		return shim.Error(fmt.Sprintf("invalid bid deadline %s", err))
+	}
+	revealDeadline, err := time.Parse(time.RFC3339, args[4])
+	if err != nil {
+		return shim.Error(fmt.Sprintf("invalid reveal deadline %s", err))
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !bidDeadline.After(now) || !revealDeadline.After(bidDeadline) {
+		return shim.Error("deadlines must satisfy now < bid deadline < reveal deadline")
+	}
+	//step3:验证数据是否存在
+	if auctionBytes, err := stub.GetState(constructAuctionKey(auctionID)); err != nil || len(auctionBytes) != 0 {
+		return shim.Error("Auction already exist")
+	}
+	if _, err := getUser(stub, sellerID); err != nil {
+		return shim.Error(err.Error())
+	}
+	asset, err := getAsset(stub, assetID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if owned, err := ownsAsset(stub, sellerID, assetID); err != nil {
+		return shim.Error(err.Error())
+	} else if !owned {
+		return shim.Error("asset owner not match")
+	}
+	if err := checkAssetTransferable(stub, asset); err != nil {
+		return shim.Error(err.Error())
+	}
+	if asset.TotalShares > 0 {
+		share, err := getAssetShare(stub, assetID, sellerID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if share.Quantity != asset.TotalShares {
+			return shim.Error("asset is co-owned, owner does not hold all shares")
+		}
+	}
+	//step4:写入状态
+	auction := &Auction{
+		ID:             auctionID,
+		AssetID:        assetID,
+		SellerID:       sellerID,
+		BidDeadline:    bidDeadline.Unix(),
+		RevealDeadline: revealDeadline.Unix(),
+		Status:         auctionOpen,
+	}
+	if err := putAuction(stub, auction); err != nil {
+		return shim.Error(err.Error())
+	}
+	//拍卖期间锁定资产
+	if err := stub.PutState(constructAssetAuctionKey(assetID), []byte(auctionID)); err != nil {
+		return shim.Error(fmt.Sprintf("save asset auction error %s", err))
+	}
+	return shim.Success(nil)
+}
+
+//提交密封出价，出价内容通过transient的bid字段传入并保存到出价方组织的私有数据集合
+func submitBid(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 2 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	auctionID := args[0]
+	bidderID := args[1]
+	if auctionID == "" || bidderID == "" {
+		return shim.Error("Invalid args")
+	}
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return shim.Error(fmt.Sprintf("get transient error %s", err))
+	}
+	bidBytes, ok := transient["bid"]
+	if !ok || len(bidBytes) == 0 {
+		return shim.Error("bid must be passed in transient field bid")
+	}
+	bid := new(PrivateBid)
+	if err := json.Unmarshal(bidBytes, bid); err != nil {
+		return shim.Error(fmt.Sprintf("unmarshal bid error %s", err))
+	}
+	if bid.Price <= 0 || bid.Salt == "" {
+		return shim.Error("bid requires positive price and non-empty salt")
+	}
+	bid.AuctionID = auctionID
+	bid.BidderID = bidderID
+	//step3:验证数据是否存在
+	auction, err := getAuction(stub, auctionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if auction.Status != auctionOpen || now.Unix() >= auction.BidDeadline {
+		return shim.Error("auction is not accepting bids")
+	}
+	if _, err := getUser(stub, bidderID); err != nil {
+		return shim.Error(err.Error())
+	}
+	if bidderID == auction.SellerID {
+		return shim.Error("seller can not bid")
+	}
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("get msp id error %s", err))
+	}
+	//step4:写入状态
+	hash, privateBytes, err := hashBid(bid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	bidID := stub.GetTxID()
+	bidKey, err := stub.CreateCompositeKey("auctionBid", []string{auctionID, bidID})
+	if err != nil {
+		return shim.Error(fmt.Sprintf("create key error %s", err))
+	}
+	if err := stub.PutPrivateData(implicitCollection(mspID), bidKey, privateBytes); err != nil {
+		return shim.Error(fmt.Sprintf("save private bid error %s", err))
+	}
+	commitment := &AuctionBid{
+		AuctionID: auctionID,
+		BidID:     bidID,
+		BidderID:  bidderID,
+		BidderOrg: mspID,
+		Hash:      hash,
+		Timestamp: now.Unix(),
+	}
+	if err := putAuctionBid(stub, bidKey, commitment); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte(bidID))
+}
+
+//揭示出价，从出价方组织私有数据集合读取出价并与链上承诺比对
+func revealBid(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 2 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	auctionID := args[0]
+	bidID := args[1]
+	if auctionID == "" || bidID == "" {
+		return shim.Error("Invalid args")
+	}
+	//step3:验证数据是否存在
+	auction, err := getAuction(stub, auctionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if auction.Status != auctionOpen || now.Unix() < auction.BidDeadline || now.Unix() >= auction.RevealDeadline {
+		return shim.Error("auction is not in reveal phase")
+	}
+	bidKey, err := stub.CreateCompositeKey("auctionBid", []string{auctionID, bidID})
+	if err != nil {
+		return shim.Error(fmt.Sprintf("create key error %s", err))
+	}
+	commitmentBytes, err := stub.GetState(bidKey)
+	if err != nil || len(commitmentBytes) == 0 {
+		return shim.Error("bid not found")
+	}
+	commitment := new(AuctionBid)
+	if err := json.Unmarshal(commitmentBytes, commitment); err != nil {
+		return shim.Error(fmt.Sprintf("unmarshal bid error %s", err))
+	}
+	if commitment.Revealed {
+		return shim.Error("bid already revealed")
+	}
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("get msp id error %s", err))
+	}
+	if mspID != commitment.BidderOrg {
+		return shim.Error("only the bidder org can reveal the bid")
+	}
+	privateBytes, err := stub.GetPrivateData(implicitCollection(mspID), bidKey)
+	if err != nil || len(privateBytes) == 0 {
+		return shim.Error("private bid not found")
+	}
+	bid := new(PrivateBid)
+	if err := json.Unmarshal(privateBytes, bid); err != nil {
+		return shim.Error(fmt.Sprintf("unmarshal bid error %s", err))
+	}
+	hash, _, err := hashBid(bid)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if hash != commitment.Hash || bid.AuctionID != auctionID || bid.BidderID != commitment.BidderID {
+		return shim.Error("revealed bid does not match commitment")
+	}
+	//step4:写入状态
+	commitment.Revealed = true
+	commitment.Price = bid.Price
+	if err := putAuctionBid(stub, bidKey, commitment); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+//结束拍卖，最高的已揭示出价获胜（同价时先出价者获胜）并转让资产
+func closeAuction(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	auctionID := args[0]
+	if auctionID == "" {
+		return shim.Error("Invalid args")
+	}
+	//step3:验证数据是否存在
+	auction, err := getAuction(stub, auctionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if auction.Status != auctionOpen {
+		return shim.Error("auction already closed")
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if now.Unix() < auction.RevealDeadline {
+		return shim.Error("auction reveal phase not finished")
+	}
+	if err := checkAssetLock(stub, auction.AssetID); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkAssetLease(stub, auction.AssetID); err != nil {
+		return shim.Error(err.Error())
+	}
+	bids, err := getAuctionBids(stub, auctionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var winner *AuctionBid
+	for _, bid := range bids {
+		if !bid.Revealed {
+			continue
+		}
+		if winner == nil || bid.Price > winner.Price ||
+			(bid.Price == winner.Price && bid.Timestamp < winner.Timestamp) {
+			winner = bid
+		}
+	}
+	//step4:写入状态
+	auction.Status = auctionClosed
+	if err := stub.DelState(constructAssetAuctionKey(auction.AssetID)); err != nil {
+		return shim.Error(fmt.Sprintf("delete asset auction error %s", err))
+	}
+	if winner != nil {
+		asset, err := getAsset(stub, auction.AssetID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if _, err := settlePayment(stub, asset, auction.SellerID, winner.BidderID, winner.Price); err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := transferWholeAsset(stub, asset, auction.SellerID, winner.BidderID, ""); err != nil {
+			return shim.Error(err.Error())
+		}
+		auction.WinnerID = winner.BidderID
+		auction.WinningPrice = winner.Price
+	}
+	if err := putAuction(stub, auction); err != nil {
+		return shim.Error(err.Error())
+	}
+	auctionBytes, err := json.Marshal(auction)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal auction error %s", err))
+	}
+	return shim.Success(auctionBytes)
+}
+
+//拍卖查询，返回拍卖信息及全部出价承诺
+func queryAuction(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	auctionID := args[0]
+	if auctionID == "" {
+		return shim.Error("Invalid args")
+	}
+	//step3:验证数据是否存在
+	auction, err := getAuction(stub, auctionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	bids, err := getAuctionBids(stub, auctionID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	resultBytes, err := json.Marshal(struct {
+		Auction *Auction      `json:"auction"`
+		Bids    []*AuctionBid `json:"bids"`
+	}{auction, bids})
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
+	}
+	return shim.Success(resultBytes)
+}
+
+//用户查询
+func queryUser(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	userID := args[0]
+	if userID == "" {
+		return shim.Error("Invalid args")
+	}
+	//step3:验证数据是否存在
+	userBytes, err := stub.GetState(constructUserKey(userID))
+	if err != nil || len(userBytes) == 0 {
+		return shim.Error("user not found")
+	}
+	return shim.Success(userBytes)
+}
+
+//资产查询
+func queryAsset(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	assetID := args[0]
+	if assetID == "" {
+		return shim.Error("Invalid args")
+	}
+	//step3:验证数据是否存在
+	assetBytes, err := stub.GetState(constructAssetKey(assetID))
+	if err != nil || len(assetBytes) == 0 {
+		return shim.Error("asset not found")
+	}
+	return shim.Success(assetBytes)
+}
+
+//资产交易记录查询
+func queryAssetHistory(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	assetID := args[0]
+	if assetID == "" {
+		return shim.Error("Invalid args")
+	}
+	queryType := "all"
+	if len(args) == 2 {
+		queryType = args[1]
+	}
+	if queryType != "all" && queryType != "enroll" && queryType != "exchange" && queryType != "retire" {
+		return shim.Error(fmt.Sprintf("queryType unknown %s", queryType))
+	}
+	//step3:验证数据是否存在，已注销的资产仍可查询
+	assetBytes, err := stub.GetState(constructAssetKey(assetID))
+	if err != nil || len(assetBytes) == 0 {
+		if tombstone, err := getAssetTombstone(stub, assetID); err != nil || tombstone == nil {
+			return shim.Error("asset not found")
+		}
+	}
+
+	//查询相关数据
+	records, err := getAssetHistories(stub, assetID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	histories := make([]*AssetHistory, 0)
+	for _, history := range records {
+		isEnroll := history.OriginOwnerID == originOwner
+		isRetire := history.CurrentOwnerID == retiredOwner
+		//过滤掉不是资产转让的记录
+		if queryType == "exchange" && (isEnroll || isRetire) {
+			continue
+		}
+		if queryType == "enroll" && !isEnroll {
+			continue
+		}
+		if queryType == "retire" && !isRetire {
+			continue
+		}
+		histories = append(histories, history)
+	}
+
+	historiesBytes, err := json.Marshal(histories)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
+	}
+	return shim.Success(historiesBytes)
+}
+
+//用户资产分页查询
+func queryUserAssets(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 && len(args) != 3 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	userID := args[0]
+	if userID == "" {
+		return shim.Error("Invalid args")
+	}
+	pageSize, bookmark, err := parsePageArgs(args[1:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//step3:验证数据是否存在
+	if _, err := getUser(stub, userID); err != nil {
+		return shim.Error(err.Error())
+	}
+	pageBytes, err := queryAssetIndexPage(stub, "owner~asset", []string{userID}, pageSize, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(pageBytes)
+}
+
+//按名称分页查询资产
+func queryAssetsByName(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 && len(args) != 3 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	name := args[0]
+	if name == "" {
+		return shim.Error("Invalid args")
+	}
+	pageSize, bookmark, err := parsePageArgs(args[1:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//step3:查询索引
+	pageBytes, err := queryAssetIndexPage(stub, "name~asset", []string{name}, pageSize, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(pageBytes)
+}
+
+//按类别分页查询资产
+func queryAssetsByClass(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 && len(args) != 3 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	classID := args[0]
+	if classID == "" {
+		return shim.Error("Invalid args")
+	}
+	pageSize, bookmark, err := parsePageArgs(args[1:])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//step3:查询索引
+	pageBytes, err := queryAssetIndexPage(stub, "class~asset", []string{classID}, pageSize, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(pageBytes)
+}
+
+//资产一致性检查，报告重复的拥有关系、重复名称及缺失的索引，repair为true时补建名称和类别索引
+func checkAssetConsistency(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) > 1 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	repair := false
+	if len(args) == 1 {
+		r, err := strconv.ParseBool(args[0])
+		if err != nil {
+			return shim.Error("Invalid args")
+		}
+		repair = r
+	}
+	if _, err := checkAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	report := &ConsistencyReport{
+		DuplicateOwners: make([]*AssetOwnersIssue, 0),
+		DuplicateNames:  make([]*AssetNameIssue, 0),
+		OrphanIndexes:   make([]string, 0),
+		OwnerMismatches: make([]*AssetOwnersIssue, 0),
+	}
+	//step3:汇总拥有者索引
+	owners := make(map[string][]string)
+	ownerResult, err := stub.GetStateByPartialCompositeKey("owner~asset", []string{})
+	if err != nil {
+		return shim.Error(fmt.Sprintf("query owner index error:%s", err))
+	}
+	defer ownerResult.Close()
+	for ownerResult.HasNext() {
+		indexVal, err := ownerResult.Next()
+		if err != nil {
+			return shim.Error(fmt.Sprintf("query error:%s", err))
+		}
+		_, attrs, err := stub.SplitCompositeKey(indexVal.GetKey())
+		if err != nil {
+			return shim.Error(fmt.Sprintf("split key error:%s", err))
+		}
+		owners[attrs[1]] = append(owners[attrs[1]], attrs[0])
+	}
+	//step4:遍历资产（asset_前缀的键）
+	names := make(map[string][]string)
+	assetResult, err := stub.GetStateByRange(constructAssetKey(""), "asset`")
+	if err != nil {
+		return shim.Error(fmt.Sprintf("query assets error:%s", err))
+	}
+	defer assetResult.Close()
+	for assetResult.HasNext() {
+		assetVal, err := assetResult.Next()
+		if err != nil {
+			return shim.Error(fmt.Sprintf("query error:%s", err))
+		}
+		asset := new(Asset)
+		if err := json.Unmarshal(assetVal.GetValue(), asset); err != nil {
+			return shim.Error(fmt.Sprintf("unmarshal asset error %s", err))
+		}
+		report.Assets++
+		names[asset.Name] = append(names[asset.Name], asset.ID)
+		assetOwners := owners[asset.ID]
+		delete(owners, asset.ID)
+		if len(assetOwners) > 1 {
+			report.DuplicateOwners = append(report.DuplicateOwners, &AssetOwnersIssue{AssetID: asset.ID, Owner: asset.Owner, Indexed: assetOwners})
+		} else if len(assetOwners) == 1 && asset.Owner != "" && asset.Owner != assetOwners[0] {
+			report.OwnerMismatches = append(report.OwnerMismatches, &AssetOwnersIssue{AssetID: asset.ID, Owner: asset.Owner, Indexed: assetOwners})
+		}
+		for _, index := range []struct {
+			name  string
+			attrs []string
+		}{
+			{"name~asset", []string{asset.Name, asset.ID}},
+			{"class~asset", []string{asset.Class, asset.ID}},
+		} {
+			if index.attrs[0] == "" {
+				continue
+			}
+			indexKey, err := stub.CreateCompositeKey(index.name, index.attrs)
+			if err != nil {
+				return shim.Error(fmt.Sprintf("create key error %s", err))
+			}
+			indexBytes, err := stub.GetState(indexKey)
+			if err != nil {
+				return shim.Error(fmt.Sprintf("query index error %s", err))
+			}
+			if len(indexBytes) != 0 {
+				continue
+			}
+			report.MissingIndexes++
+			if repair {
+				if err := stub.PutState(indexKey, []byte{0x00}); err != nil {
+					return shim.Error(fmt.Sprintf("save index error %s", err))
+				}
+			}
+		}
+	}
+	for assetID := range owners {
+		report.OrphanIndexes = append(report.OrphanIndexes, assetID)
+	}
+	sort.Strings(report.OrphanIndexes)
+	nameList := make([]string, 0, len(names))
+	for name := range names {
+		nameList = append(nameList, name)
+	}
+	sort.Strings(nameList)
+	for _, name := range nameList {
+		if len(names[name]) > 1 {
+			report.DuplicateNames = append(report.DuplicateNames, &AssetNameIssue{Name: name, AssetIDs: names[name]})
+		}
+	}
+	reportBytes, err := json.Marshal(report)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
+	}
+	return shim.Success(reportBytes)
+}
+
+//将旧版本User.Assets列表迁移为owner~asset索引，每次处理一批用户，返回下一批的起始键
+//仅管理组织可调用；已迁移的用户资产列表为空，重复调用不会重复写入
+func migrateUserAssets(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) > 2 {
+		return shim.Error("Not enough args")
+	}
+	if _, err := checkAdmin(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	//step2:验证参数正确性
+	batchSize := defaultPageSize
+	startKey := constructUserKey("")
+	if len(args) >= 1 {
+		size, err := strconv.Atoi(args[0])
+		if err != nil || size <= 0 {
+			return shim.Error("Invalid args")
+		}
+		batchSize = size
+	}
+	if len(args) == 2 && args[1] != "" {
+		startKey = args[1]
+	}
+	//step3:遍历用户（user_前缀的键，结束键为前缀的下一个字符）
+	result, err := stub.GetStateByRange(startKey, "user`")
+	if err != nil {
+		return shim.Error(fmt.Sprintf("query users error:%s", err))
+	}
+	defer result.Close()
+
+	migration := new(MigrationResult)
+	//本批次内已补全拥有者的资产（同一交易内GetState读不到本交易的写入）
+	claimed := make(map[string]string)
+	for result.HasNext() {
+		userVal, err := result.Next()
+		if err != nil {
+			return shim.Error(fmt.Sprintf("query error:%s", err))
+		}
+		if migration.Users == batchSize {
+			migration.Bookmark = userVal.GetKey()
+			break
+		}
+		migration.Users++
+		user := new(User)
+		if err := json.Unmarshal(userVal.GetValue(), user); err != nil {
+			return shim.Error(fmt.Sprintf("unmarshal user error %s", err))
+		}
+		if len(user.Assets) == 0 {
+			continue
+		}
+		//step4:写入索引，补全资产拥有者并清空旧列表
+		for _, aid := range user.Assets {
+			asset, err := getAsset(stub, aid)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			//资产已登记或已在本批次中归属其他用户时，旧列表中的记录已失效
+			if asset.Owner == "" {
+				if owner, ok := claimed[aid]; ok && owner != user.ID {
+					continue
+				}
+			} else if asset.Owner != user.ID {
+				continue
+			}
+			if err := putOwnerIndex(stub, user.ID, aid); err != nil {
+				return shim.Error(err.Error())
+			}
+			ownedKey, err := stub.CreateCompositeKey("ownerHistory", []string{user.ID, aid})
+			if err != nil {
+				return shim.Error(fmt.Sprintf("create key error %s", err))
+			}
+			if err := stub.PutState(ownedKey, []byte{0x00}); err != nil {
+				return shim.Error(fmt.Sprintf("save owner history error %s", err))
+			}
+			if asset.Owner == "" {
+				asset.Owner = user.ID
+				claimed[aid] = user.ID
+				if err := putAsset(stub, asset); err != nil {
+					return shim.Error(err.Error())
+				}
+			}
+			migration.Assets++
+		}
+		user.Assets = nil
+		if err := putUser(stub, user); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	migrationBytes, err := json.Marshal(migration)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
+	}
+	return shim.Success(migrationBytes)
+}
+
+//资产有效背书策略查询
+func queryAssetEndorsementPolicy(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	assetID := args[0]
+	if assetID == "" {
+		return shim.Error("Invalid args")
+	}
+	//step3:验证数据是否存在
+	if _, err := getAsset(stub, assetID); err != nil {
+		return shim.Error(err.Error())
+	}
+	policyBytes, err := stub.GetStateValidationParameter(constructAssetKey(assetID))
+	if err != nil {
+		return shim.Error(fmt.Sprintf("query endorsement policy error %s", err))
+	}
+	policy := &AssetEndorsementPolicy{AssetID: assetID, Orgs: make([]string, 0)}
+	if len(policyBytes) != 0 {
+		ep, err := statebased.NewStateEP(policyBytes)
+		if err != nil {
+			return shim.Error(fmt.Sprintf("parse endorsement policy error %s", err))
+		}
+		policy.KeyLevel = true
+		policy.Orgs = ep.ListOrgs()
+	}
+	policyBytes, err = json.Marshal(policy)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
+	}
+	return shim.Success(policyBytes)
+}
+
+//单个资产授权查询
+func queryApproval(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	assetID := args[0]
+	if assetID == "" {
+		return shim.Error("Invalid args")
+	}
+	//step3:验证数据是否存在
+	asset, err := getAsset(stub, assetID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	approval := &AssetApproval{AssetID: assetID, OwnerID: asset.Owner}
+	approvalBytes, err := stub.GetState(constructApprovalKey(assetID))
+	if err != nil {
+		return shim.Error(fmt.Sprintf("query approval error %s", err))
+	}
+	if len(approvalBytes) != 0 {
+		if err := json.Unmarshal(approvalBytes, approval); err != nil {
+			return shim.Error(fmt.Sprintf("unmarshal approval error %s", err))
+		}
+	}
+	approvalBytes, err = json.Marshal(approval)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
+	}
+	return shim.Success(approvalBytes)
+}
+
+//操作员全部资产授权查询
+func queryApprovalForAll(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 2 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	ownerID := args[0]
+	operatorID := args[1]
+	if ownerID == "" || operatorID == "" {
+		return shim.Error("Invalid args")
+	}
+	//step3:查询授权
+	operatorKey, err := constructOperatorKey(stub, ownerID, operatorID)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("create key error %s", err))
+	}
+	operatorBytes, err := stub.GetState(operatorKey)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("query operator approval error %s", err))
+	}
+	approval := &OperatorApproval{OwnerID: ownerID, OperatorID: operatorID, Approved: len(operatorBytes) != 0}
+	approvalBytes, err := json.Marshal(approval)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
+	}
+	return shim.Success(approvalBytes)
+}
+
+//资产有偿转让分账记录查询
+func queryAssetPayments(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	assetID := args[0]
+	if assetID == "" {
+		return shim.Error("Invalid args")
+	}
+	//step3:查询分账记录
+	result, err := stub.GetStateByPartialCompositeKey("payment", []string{assetID})
+	if err != nil {
+		return shim.Error(fmt.Sprintf("query payment error:%s", err))
+	}
+	defer result.Close()
+	records := make([]*PaymentRecord, 0)
+	for result.HasNext() {
+		paymentVal, err := result.Next()
+		if err != nil {
+			return shim.Error(fmt.Sprintf("query error:%s", err))
+		}
+		record := new(PaymentRecord)
+		if err := json.Unmarshal(paymentVal.GetValue(), record); err != nil {
+			return shim.Error(fmt.Sprintf("unmashal error:%s", err))
+		}
+		records = append(records, record)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Timestamp < records[j].Timestamp
+	})
+	recordsBytes, err := json.Marshal(records)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
+	}
+	return shim.Success(recordsBytes)
+}
+
+//资产类别查询
+func queryAssetClass(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	classID := args[0]
+	if classID == "" {
+		return shim.Error("Invalid args")
+	}
+	//step3:验证数据是否存在
+	classBytes, err := stub.GetState(constructAssetClassKey(classID))
+	if err != nil || len(classBytes) == 0 {
+		return shim.Error("asset class not found")
+	}
+	return shim.Success(classBytes)
+}
+
+//资产元数据版本查询，不指定版本时返回全部历史版本及当前版本
+func queryAssetMetadata(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	assetID := args[0]
+	if assetID == "" {
+		return shim.Error("Invalid args")
+	}
+	var version int64
+	if len(args) == 2 {
+		v, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || v <= 0 {
+			return shim.Error("Invalid args")
+		}
+		version = v
+	}
+	//step3:验证数据是否存在
+	asset, err := getAsset(stub, assetID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	current := &AssetMetadataVersion{AssetID: assetID, Version: asset.MetadataVer, Metadata: asset.Metadata}
+	if current.Version == 0 {
+		current.Version = 1
+	}
+	versions := make([]*AssetMetadataVersion, 0)
+	result, err := stub.GetStateByPartialCompositeKey("metadata", []string{assetID})
+	if err != nil {
+		return shim.Error(fmt.Sprintf("query metadata error:%s", err))
+	}
+	defer result.Close()
+	for result.HasNext() {
+		versionVal, err := result.Next()
+		if err != nil {
+			return shim.Error(fmt.Sprintf("query error:%s", err))
+		}
+		previous := new(AssetMetadataVersion)
+		if err := json.Unmarshal(versionVal.GetValue(), previous); err != nil {
+			return shim.Error(fmt.Sprintf("unmashal error:%s", err))
+		}
+		versions = append(versions, previous)
+	}
+	versions = append(versions, current)
+	if version == 0 {
+		versionsBytes, err := json.Marshal(versions)
+		if err != nil {
+			return shim.Error(fmt.Sprintf("marshal error %s", err))
+		}
+		return shim.Success(versionsBytes)
+	}
+	for _, v := range versions {
+		if v.Version == version {
+			versionBytes, err := json.Marshal(v)
+			if err != nil {
+				return shim.Error(fmt.Sprintf("marshal error %s", err))
+			}
+			return shim.Success(versionBytes)
+		}
+	}
+	return shim.Error("metadata version not found")
+}
+
+//资产注销记录查询
+func queryAssetTombstone(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	//step1:检查参数个数
-	if len(args) != 2 {
+	if len(args) != 1 {
 		return shim.Error("Not enough args")
 	}
 	//step2:验证参数正确性
-	name := args[0]
-	id := args[1]
-	if name == "" || id == "" {
+	assetID := args[0]
+	if assetID == "" {
 		return shim.Error("Invalid args")
 	}
 	//step3:验证数据是否存在
-	if userBytes, err := stub.GetState(constructUserKey(id)); err != nil || len(userBytes) != 0 {
-		return shim.Error("User already exist")
-	}
-	//step4:写入状态
-	user := User{Name: name, ID: id, Assets: make([]string, 0)}
-	//序列化对象
-	userBytes, err := json.Marshal(user)
+	tombstone, err := getAssetTombstone(stub, assetID)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("marshal user error %s", err))
+		return shim.Error(err.Error())
 	}
-	err = stub.PutState(constructUserKey(id), userBytes)
+	if tombstone == nil {
+		return shim.Error("asset not retired")
+	}
+	tombstoneBytes, err := json.Marshal(tombstone)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("put user error %s", err))
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
 	}
-	return shim.Success(nil)
+	return shim.Success(tombstoneBytes)
 }
 
-//资产登记
-func assetEnroll(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+//资产冻结查询
+func queryAssetLock(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	//step1:检查参数个数
-	if len(args) != 4 {
+	if len(args) != 1 {
 		return shim.Error("Not enough args")
 	}
 	//step2:验证参数正确性
-	assetName := args[0]
-	assetId := args[1]
-	metadata := args[2]
-	ownerId := args[3]
-	if assetName == "" || assetId == "" || ownerId == "" {
+	assetID := args[0]
+	if assetID == "" {
 		return shim.Error("Invalid args")
 	}
 	//step3:验证数据是否存在
-	userBytes, err := stub.GetState(constructUserKey(ownerId))
-	if err != nil || len(userBytes) == 0 {
-		return shim.Error("User not found")
-	}
-	if assetBytes, err := stub.GetState(constructAssetKey(assetName)); err == nil && len(assetBytes) != 0 {
-		return shim.Error("Asset already exist")
-	}
-	//step4:写入状态
-	asset := Asset{Name: assetName, ID: assetId, Metadata: metadata}
-	assetBytes, err := json.Marshal(asset)
+	lock, err := getAssetLock(stub, assetID)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("marshal asset error %s", err))
-	}
-	if err := stub.PutState(constructAssetKey(assetId), assetBytes); err != nil {
-		return shim.Error(fmt.Sprintf("save asset error %s", err))
+		return shim.Error(err.Error())
 	}
-	user := new(User)
-	//反序列化user
-	if err := json.Unmarshal(userBytes, user); err != nil {
-		return shim.Error(fmt.Sprintf("unmarshal user error %s", err))
+	if lock == nil {
+		return shim.Error("asset is not locked")
 	}
-	user.Assets = append(user.Assets, assetId)
-	//序列化user
-	userBytes, err = json.Marshal(user)
+	lockBytes, err := json.Marshal(lock)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("marshal user error %s", err))
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
 	}
-	if err := stub.PutState(constructUserKey(user.ID), userBytes); err != nil {
-		return shim.Error(fmt.Sprintf("update user error %s", err))
+	return shim.Success(lockBytes)
+}
+
+//资产租约查询
+func queryAssetLeases(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 {
+		return shim.Error("Not enough args")
 	}
-	//资产变更历史
-	history := &AssetHistory{AssetID: assetId, OriginOwnerID: originOwner, CurrentOwnerID: ownerId}
-	historyBytes, err := json.Marshal(history)
-	if err != nil {
-		return shim.Error(fmt.Sprintf("marshal asset history error: %s", err))
+	//step2:验证参数正确性
+	assetID := args[0]
+	if assetID == "" {
+		return shim.Error("Invalid args")
 	}
-	historyKey, err := stub.CreateCompositeKey("history", []string{
-		assetId, originOwner, ownerId,
-	})
+	//step3:查询租约
+	leases, err := getAssetLeases(stub, assetID)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("create key error: %s", err))
+		return shim.Error(err.Error())
 	}
-	if err := stub.PutState(historyKey, historyBytes); err != nil {
-		return shim.Error(fmt.Sprintf("save asset history error: %s", err))
+	leasesBytes, err := json.Marshal(leases)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
 	}
-	return shim.Success(historyBytes)
+	return shim.Success(leasesBytes)
 }
 
-//资产转让
-func assetExchange(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+//按交易时间查询资产当前的使用权人，处于租期内时为承租人，否则为拥有者
+func queryRightsHolder(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	//step1:检查参数个数
-	if len(args) != 3 {
+	if len(args) != 1 {
 		return shim.Error("Not enough args")
 	}
 	//step2:验证参数正确性
-	ownerID := args[0]
-	assetID := args[1]
-	currentOwnerID := args[2]
-	if ownerID == "" || assetID == "" || currentOwnerID == "" {
+	assetID := args[0]
+	if assetID == "" {
 		return shim.Error("Invalid args")
 	}
 	//step3:验证数据是否存在
-	originOwnerBytes, err := stub.GetState(constructUserKey(ownerID))
-	if err != nil || len(originOwnerBytes) == 0 {
-		return shim.Error("User not found")
-	}
-	currentOwnerBytes, err := stub.GetState(constructUserKey(currentOwnerID))
-	if err != nil || len(currentOwnerBytes) == 0 {
-		return shim.Error("User not found")
+	asset, err := getAsset(stub, assetID)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-	assetBytes, err := stub.GetState(constructAssetKey(assetID))
-	if err != nil || len(assetBytes) == 0 {
-		return shim.Error("asset not found")
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-	//校验原始拥有着确实拥有当前变更的资产
-	originOwner := new(User)
-	//反序列化user
-	if err := json.Unmarshal(originOwnerBytes, originOwner); err != nil {
-		return shim.Error(fmt.Sprintf("unmarshal user error %s", err))
+	leases, err := getAssetLeases(stub, assetID)
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-	aidexist := false
-	for _, aid := range originOwner.Assets {
-		if aid == assetID {
-			aidexist = true
+	holder := &RightsHolder{AssetID: assetID, OwnerID: asset.Owner, HolderID: asset.Owner, At: now.Unix()}
+	for _, lease := range leases {
+		if lease.Start <= now.Unix() && now.Unix() < lease.End {
+			holder.HolderID = lease.LesseeID
+			holder.LeaseID = lease.ID
 			break
 		}
 	}
-	if !aidexist {
-		return shim.Error("asset owner not match")
-	}
-	//step4:写入状态
-	assetIds := make([]string, 0)
-	for _, aid := range originOwner.Assets {
-		if aid == assetID {
-			continue
-		}
-		assetIds = append(assetIds, aid)
+	holderBytes, err := json.Marshal(holder)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
 	}
-	originOwner.Assets = assetIds
+	return shim.Success(holderBytes)
+}
 
-	originOwnerBytes, err = json.Marshal(originOwner)
+//资产哈希时间锁查询
+func queryAssetHTLC(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	assetID := args[0]
+	if assetID == "" {
+		return shim.Error("Invalid args")
+	}
+	//step3:验证数据是否存在
+	htlc, err := getAssetHTLC(stub, assetID)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("marshal user error %s", err))
+		return shim.Error(err.Error())
 	}
-	if err := stub.PutState(constructUserKey(ownerID), originOwnerBytes); err != nil {
-		return shim.Error(fmt.Sprintf("update user error %s", err))
+	if htlc == nil {
+		return shim.Error("htlc not found")
 	}
-
-	//当前拥有者插入资产id
-	currentOwner := new(User)
-	//反序列化user
-	if err := json.Unmarshal(currentOwnerBytes, currentOwner); err != nil {
-		return shim.Error(fmt.Sprintf("unmarshal user error %s", err))
+	htlcBytes, err := json.Marshal(htlc)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
 	}
-	currentOwner.Assets = append(currentOwner.Assets, assetID)
+	return shim.Success(htlcBytes)
+}
 
-	currentOwnerBytes, err = json.Marshal(currentOwner)
-	if err != nil {
-		return shim.Error(fmt.Sprintf("marshal user error %s", err))
+//资产份额登记册查询
+func queryCapTable(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 {
+		return shim.Error("Not enough args")
 	}
-	if err := stub.PutState(constructUserKey(currentOwnerID), currentOwnerBytes); err != nil {
-		return shim.Error(fmt.Sprintf("update user error %s", err))
+	//step2:验证参数正确性
+	assetID := args[0]
+	if assetID == "" {
+		return shim.Error("Invalid args")
 	}
-
-	//插入资产变更记录
-	history := &AssetHistory{AssetID: assetID, OriginOwnerID: ownerID, CurrentOwnerID: currentOwnerID}
-	historyBytes, err := json.Marshal(history)
+	//step3:验证数据是否存在
+	asset, err := getAsset(stub, assetID)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("marshal asset history error %s", err))
+		return shim.Error(err.Error())
 	}
-	historyKey, err := stub.CreateCompositeKey("history", []string{
-		assetID, ownerID, currentOwnerID,
-	})
-	if err != nil {
-		return shim.Error(fmt.Sprintf("create key error %s", err))
+	capTable := &CapTable{AssetID: assetID, TotalShares: asset.TotalShares, Shares: make([]*AssetShare, 0)}
+	if asset.TotalShares == 0 {
+		//未拆分的资产由登记拥有者持有全部
+		capTable.TotalShares = 1
+		capTable.Shares = append(capTable.Shares, &AssetShare{AssetID: assetID, HolderID: asset.Owner, Quantity: 1})
+	} else {
+		result, err := stub.GetStateByPartialCompositeKey("share", []string{assetID})
+		if err != nil {
+			return shim.Error(fmt.Sprintf("query share error:%s", err))
+		}
+		defer result.Close()
+		for result.HasNext() {
+			shareVal, err := result.Next()
+			if err != nil {
+				return shim.Error(fmt.Sprintf("query error:%s", err))
+			}
+			share := new(AssetShare)
+			if err := json.Unmarshal(shareVal.GetValue(), share); err != nil {
+				return shim.Error(fmt.Sprintf("unmashal error:%s", err))
+			}
+			capTable.Shares = append(capTable.Shares, share)
+		}
 	}
-
-	if err := stub.PutState(historyKey, historyBytes); err != nil {
-		return shim.Error(fmt.Sprintf("save asset history error %s", err))
+	capTableBytes, err := json.Marshal(capTable)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
 	}
-	return shim.Success(nil)
+	return shim.Success(capTableBytes)
 }
 
-//用户查询
-func queryUser(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+//用户持有的资产份额查询
+func queryUserShares(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	//step1:检查参数个数
 	if len(args) != 1 {
 		return shim.Error("Not enough args")
@@ -240,17 +3741,55 @@ func queryUser(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 		return shim.Error("Invalid args")
 	}
 	//step3:验证数据是否存在
-	userBytes, err := stub.GetState(constructUserKey(userID))
-	if err != nil || len(userBytes) == 0 {
-		return shim.Error("user not found")
+	if _, err := getUser(stub, userID); err != nil {
+		return shim.Error(err.Error())
 	}
-	return shim.Success(userBytes)
+	assetIDs, err := getOwnedAssetIDs(stub, userID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	shares := make([]*AssetShare, 0)
+	//未拆分的资产按1/1份额返回
+	for _, aid := range assetIDs {
+		asset, err := getAsset(stub, aid)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if asset.TotalShares == 0 {
+			shares = append(shares, &AssetShare{AssetID: aid, HolderID: userID, Quantity: 1})
+		}
+	}
+	result, err := stub.GetStateByPartialCompositeKey("holder~asset", []string{userID})
+	if err != nil {
+		return shim.Error(fmt.Sprintf("query share error:%s", err))
+	}
+	defer result.Close()
+	for result.HasNext() {
+		indexVal, err := result.Next()
+		if err != nil {
+			return shim.Error(fmt.Sprintf("query error:%s", err))
+		}
+		_, attrs, err := stub.SplitCompositeKey(indexVal.GetKey())
+		if err != nil {
+			return shim.Error(fmt.Sprintf("split key error:%s", err))
+		}
+		share, err := getAssetShare(stub, attrs[1], userID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		shares = append(shares, share)
+	}
+	sharesBytes, err := json.Marshal(shares)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
+	}
+	return shim.Success(sharesBytes)
 }
 
-//资产查询
-func queryAsset(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+//查询资产在某一时刻的拥有者
+func queryOwnerAt(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	//step1:检查参数个数
-	if len(args) != 1 {
+	if len(args) != 2 {
 		return shim.Error("Not enough args")
 	}
 	//step2:验证参数正确性
@@ -258,85 +3797,174 @@ func queryAsset(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	if assetID == "" {
 		return shim.Error("Invalid args")
 	}
-	//step3:验证数据是否存在
-	assetBytes, err := stub.GetState(constructAssetKey(assetID))
-	if err != nil || len(assetBytes) == 0 {
-		return shim.Error("asset not found")
+	at, err := parseQueryTime(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-	return shim.Success(assetBytes)
+	//step3:查询变更记录
+	ownership, err := ownershipAt(stub, assetID, at)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if ownership == nil {
+		return shim.Error("asset not enrolled at the given time")
+	}
+	if ownership.OwnerID == retiredOwner {
+		return shim.Error("asset retired at the given time")
+	}
+	ownershipBytes, err := json.Marshal(ownership)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
+	}
+	return shim.Success(ownershipBytes)
 }
 
-//资产交易记录查询
-func queryAssetHistory(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+//查询用户在某一时刻持有的资产
+func queryHoldingsAt(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	//step1:检查参数个数
-	if len(args) != 1 && len(args) != 2 {
+	if len(args) != 2 {
 		return shim.Error("Not enough args")
 	}
 	//step2:验证参数正确性
-	assetID := args[0]
-	if assetID == "" {
+	userID := args[0]
+	if userID == "" {
 		return shim.Error("Invalid args")
 	}
-	queryType := "all"
-	if len(args) == 2 {
-		queryType = args[1]
-	}
-	if queryType != "all" && queryType != "enroll" && queryType != "exchange" {
-		return shim.Error(fmt.Sprintf("queryType unknown %s", queryType))
+	at, err := parseQueryTime(args[1])
+	if err != nil {
+		return shim.Error(err.Error())
 	}
 	//step3:验证数据是否存在
-	assetBytes, err := stub.GetState(constructAssetKey(assetID))
-	if err != nil || len(assetBytes) == 0 {
-		return shim.Error("asset not found")
+	if _, err := getUser(stub, userID); err != nil {
+		return shim.Error(err.Error())
+	}
+	//候选资产：曾经持有过的资产及当前持有的资产
+	candidates := make([]string, 0)
+	seen := make(map[string]bool)
+	result, err := stub.GetStateByPartialCompositeKey("ownerHistory", []string{userID})
+	if err != nil {
+		return shim.Error(fmt.Sprintf("query owner history error:%s", err))
+	}
+	defer result.Close()
+	for result.HasNext() {
+		indexVal, err := result.Next()
+		if err != nil {
+			return shim.Error(fmt.Sprintf("query error:%s", err))
+		}
+		_, attrs, err := stub.SplitCompositeKey(indexVal.GetKey())
+		if err != nil {
+			return shim.Error(fmt.Sprintf("split key error:%s", err))
+		}
+		if !seen[attrs[1]] {
+			seen[attrs[1]] = true
+			candidates = append(candidates, attrs[1])
+		}
+	}
+	assetIDs, err := getOwnedAssetIDs(stub, userID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, aid := range assetIDs {
+		if !seen[aid] {
+			seen[aid] = true
+			candidates = append(candidates, aid)
+		}
 	}
 
-	//查询相关数据
-	keys := make([]string, 0)
-	keys = append(keys, assetID)
-	switch queryType {
-	case "enroll":
-		keys = append(keys, originOwner)
-	case "exchange", "all": //不添加任何附件key
-	default:
-		return shim.Error(fmt.Sprintf("unsupport queryType:%s", queryType))
+	holdings := make([]*OwnershipAt, 0)
+	for _, aid := range candidates {
+		ownership, err := ownershipAt(stub, aid, at)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if ownership != nil && ownership.OwnerID == userID {
+			holdings = append(holdings, ownership)
+		}
+	}
+	holdingsBytes, err := json.Marshal(holdings)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal error %s", err))
+	}
+	return shim.Success(holdingsBytes)
+}
+
+//根据资产键的账本历史(GetHistoryForKey)还原完整的拥有者变更过程
+func queryAssetProvenance(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//step1:检查参数个数
+	if len(args) != 1 {
+		return shim.Error("Not enough args")
+	}
+	//step2:验证参数正确性
+	assetID := args[0]
+	if assetID == "" {
+		return shim.Error("Invalid args")
 	}
-	result, err := stub.GetStateByPartialCompositeKey("history", keys)
+	//step3:查询账本历史
+	result, err := stub.GetHistoryForKey(constructAssetKey(assetID))
 	if err != nil {
 		return shim.Error(fmt.Sprintf("query history error:%s", err))
 	}
 	defer result.Close()
 
-	histories := make([]*AssetHistory, 0)
+	provenance := make([]*AssetProvenance, 0)
 	for result.HasNext() {
-		historyVal, err := result.Next()
+		modification, err := result.Next()
 		if err != nil {
 			return shim.Error(fmt.Sprintf("query error:%s", err))
 		}
-
-		history := new(AssetHistory)
-		if err := json.Unmarshal(historyVal.GetValue(), history); err != nil {
-			return shim.Error(fmt.Sprintf("unmashal error:%s", err))
+		record := &AssetProvenance{
+			TxID:      modification.GetTxId(),
+			Timestamp: modification.GetTimestamp().GetSeconds(),
+			IsDelete:  modification.GetIsDelete(),
 		}
-
-		//过滤掉不是资产转让的记录
-		if queryType == "exchange" && history.OriginOwnerID == originOwner {
-			continue
+		if !record.IsDelete {
+			asset := new(Asset)
+			if err := json.Unmarshal(modification.GetValue(), asset); err != nil {
+				return shim.Error(fmt.Sprintf("unmashal error:%s", err))
+			}
+			record.OwnerID = asset.Owner
+			//拥有者未变化的修改（如元数据、份额拆分）不计入
+			if n := len(provenance); n > 0 && !provenance[n-1].IsDelete && provenance[n-1].OwnerID == record.OwnerID {
+				continue
+			}
 		}
-
-		histories = append(histories, history)
+		provenance = append(provenance, record)
+	}
+	//GetHistoryForKey按时间倒序返回，转为正序
+	for i, j := 0, len(provenance)-1; i < j; i, j = i+1, j-1 {
+		provenance[i], provenance[j] = provenance[j], provenance[i]
 	}
 
-	historiesBytes, err := json.Marshal(histories)
+	provenanceBytes, err := json.Marshal(provenance)
 	if err != nil {
 		return shim.Error(fmt.Sprintf("marshal error %s", err))
 	}
-	return shim.Success(historiesBytes)
+	return shim.Success(provenanceBytes)
 }
 
 type AssetExchangeChainCode struct {
 }
 
+// Init可选参数为JSON格式的链码配置，不传时保留已有配置
 func (t *AssetExchangeChainCode) Init(stub shim.ChaincodeStubInterface) peer.Response {
+	_, args := stub.GetFunctionAndParameters()
+	if len(args) == 0 {
+		return shim.Success(nil)
+	}
+	if len(args) != 1 {
+		return shim.Error("Parameter error while Init")
+	}
+	config := new(Config)
+	if err := json.Unmarshal([]byte(args[0]), config); err != nil {
+		return shim.Error(fmt.Sprintf("unmarshal config error %s", err))
+	}
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("marshal config error %s", err))
+	}
+	if err := stub.PutState(configKey, configBytes); err != nil {
+		return shim.Error(fmt.Sprintf("save config error %s", err))
+	}
 	return shim.Success(nil)
 }
 func (t *AssetExchangeChainCode) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
@@ -348,16 +3976,103 @@ func (t *AssetExchangeChainCode) Invoke(stub shim.ChaincodeStubInterface) peer.R
 		return assetEnroll(stub, args)
 	case "assetExchange":
 		return assetExchange(stub, args)
+	case "registerAssetClass":
+		return registerAssetClass(stub, args)
+	case "updateAssetMetadata":
+		return updateAssetMetadata(stub, args)
+	case "batchEnroll":
+		return batchEnroll(stub, args)
+	case "batchTransfer":
+		return batchTransfer(stub, args)
+	case "approve":
+		return approve(stub, args)
+	case "setApprovalForAll":
+		return setApprovalForAll(stub, args)
+	case "retireAsset":
+		return retireAsset(stub, args)
+	case "lockAsset":
+		return lockAsset(stub, args)
+	case "unlockAsset":
+		return unlockAsset(stub, args)
+	case "assetSale":
+		return assetSale(stub, args)
+	case "setAssetClassRoyalties":
+		return setAssetClassRoyalties(stub, args)
+	case "grantLease":
+		return grantLease(stub, args)
+	case "terminateLease":
+		return terminateLease(stub, args)
+	case "lockAssetHTLC":
+		return lockAssetHTLC(stub, args)
+	case "claimAssetHTLC":
+		return claimAssetHTLC(stub, args)
+	case "refundAssetHTLC":
+		return refundAssetHTLC(stub, args)
+	case "assetSplit":
+		return assetSplit(stub, args)
+	case "shareTransfer":
+		return shareTransfer(stub, args)
 	case "queryUser":
 		return queryUser(stub, args)
 	case "queryAsset":
 		return queryAsset(stub, args)
+	case "queryApproval":
+		return queryApproval(stub, args)
+	case "queryApprovalForAll":
+		return queryApprovalForAll(stub, args)
+	case "queryAssetEndorsementPolicy":
+		return queryAssetEndorsementPolicy(stub, args)
+	case "queryUserAssets":
+		return queryUserAssets(stub, args)
+	case "queryAssetsByName":
+		return queryAssetsByName(stub, args)
+	case "queryAssetsByClass":
+		return queryAssetsByClass(stub, args)
+	case "checkAssetConsistency":
+		return checkAssetConsistency(stub, args)
+	case "migrateUserAssets":
+		return migrateUserAssets(stub, args)
 	case "queryAssetHistory":
-		queryAssetHistory(stub, args)
+		return queryAssetHistory(stub, args)
+	case "queryAssetProvenance":
+		return queryAssetProvenance(stub, args)
+	case "queryOwnerAt":
+		return queryOwnerAt(stub, args)
+	case "queryHoldingsAt":
+		return queryHoldingsAt(stub, args)
+	case "createAuction":
+		return createAuction(stub, args)
+	case "submitBid":
+		return submitBid(stub, args)
+	case "revealBid":
+		return revealBid(stub, args)
+	case "closeAuction":
+		return closeAuction(stub, args)
+	case "queryAuction":
+		return queryAuction(stub, args)
+	case "queryAssetPayments":
+		return queryAssetPayments(stub, args)
+	case "queryAssetClass":
+		return queryAssetClass(stub, args)
+	case "queryAssetMetadata":
+		return queryAssetMetadata(stub, args)
+	case "queryAssetTombstone":
+		return queryAssetTombstone(stub, args)
+	case "queryAssetLock":
+		return queryAssetLock(stub, args)
+	case "queryAssetLeases":
+		return queryAssetLeases(stub, args)
+	case "queryRightsHolder":
+		return queryRightsHolder(stub, args)
+	case "queryAssetHTLC":
+		return queryAssetHTLC(stub, args)
+	case "queryCapTable":
+		return queryCapTable(stub, args)
+	case "queryUserShares":
+		return queryUserShares(stub, args)
 	default:
 		return shim.Error(fmt.Sprintf("unsupport function: %s", functionName))
 	}
-	return shim.Success(nil)
 }
 
 func main() {
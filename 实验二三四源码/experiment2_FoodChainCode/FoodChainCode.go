@@ -1,10 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"experiment2_FoodChainCode/traceverify"
 	"fmt"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
 	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type FoodChainCode struct {
@@ -35,10 +43,17 @@ type ProInfo struct {
 	FoodMFRSName string `json:"FoodMFRSName"` //食品生产商名称
 	FoodProPrice string `json:"FoodProPrice"` //食品生产价格
 	FoodProPlace string `json:"FoodProPlace"` //食品生产所在地
+	FoodMFRSMSP  string `json:"FoodMFRSMSP"`  //录入生产信息的生产商所属组织
+
+	Writer *Writer `json:"Writer,omitempty"` //录入者身份
 }
 type IngInfo struct {
-	IngID   string `json:"IngID"`   //配料ID
-	IngName string `json:"IngName"` //配料名称
+	IngID     string `json:"IngID"`               //配料ID
+	IngName   string `json:"IngName"`             //配料名称
+	IngFoodID string `json:"IngFoodID,omitempty"` //配料对应的上游食品ID
+	IngLOT    string `json:"IngLOT,omitempty"`    //配料对应的上游食品批次号
+
+	Writer *Writer `json:"Writer,omitempty"` //录入者身份
 }
 type LogInfo struct {
 	LogDepartureTm string `json:"LogDepartureTm"` //出发时间
@@ -51,9 +66,252 @@ type LogInfo struct {
 	LogMOT         string `json:"LogMOT"`         //运送方式
 	LogCopName     string `json:"LogCopName"`     //物流公司名称
 	LogCost        string `json:"LogCost"`        //费用
+
+	Writer   *Writer `json:"Writer,omitempty"`   //录入者身份，即发货方
+	Receiver *Writer `json:"Receiver,omitempty"` //收货方身份
+
+	ShipTxID         string        `json:"ShipTxID,omitempty"`         //发货交易ID
+	Quantity         string        `json:"Quantity,omitempty"`         //发货数量
+	ReceivedQuantity string        `json:"ReceivedQuantity,omitempty"` //收货数量
+	Discrepancies    []Discrepancy `json:"Discrepancies,omitempty"`    //收货时发现的差异
+}
+
+// Discrepancy 收货差异
+type Discrepancy struct {
+	Type   string `json:"Type"`   //差异类型：quantity、damage、late
+	Detail string `json:"Detail"` //差异说明
+}
+
+//收货差异类型
+const (
+	discrepancyQuantity = "quantity"
+	discrepancyDamage   = "damage"
+	discrepancyLate     = "late"
+)
+
+// Shipment 已发货待收货的物流信息，收货方确认后才写入物流信息
+type Shipment struct {
+	FoodID            string  `json:"FoodID"`
+	FoodLogInfo       LogInfo `json:"FoodLogInfo"`       //发货方填写的物流信息
+	ReceiverMSP       string  `json:"ReceiverMSP"`       //收货方组织
+	ExpectedArrivalTm string  `json:"ExpectedArrivalTm"` //预计到达时间
+	ShippedAt         string  `json:"ShippedAt"`         //发货交易时间
+}
+
+//待收货物流信息的复合键对象类型
+const shipmentObjectType = "food~ship"
+
+// ChainAnomaly 物流链异常
+type ChainAnomaly struct {
+	LogSeq int    `json:"LogSeq"` //物流信息序号
+	Field  string `json:"Field"`  //异常字段
+	Detail string `json:"Detail"` //异常说明
+}
+
+// Writer 记录录入者身份
+type Writer struct {
+	MSPID string `json:"MSPID"` //所属组织
+	ID    string `json:"ID"`    //客户端证书标识
+}
+
+//各类记录的复合键对象类型
+const (
+	proObjectType = "food~pro"
+	ingObjectType = "food~ing"
+	logObjectType = "food~log"
+)
+
+//追溯索引的复合键对象类型
+const (
+	lotIndex    = "lot~food"    //批次号 -> 食品
+	ingIndex    = "ing~food"    //上游食品 -> 使用它作为配料的食品
+	ingLotIndex = "inglot~food" //上游批次号 -> 使用它作为配料的食品
+	ingIDIndex  = "ingid~food"  //配料ID -> 使用该配料的食品
+)
+
+//召回记录的复合键对象类型
+const (
+	recallObjectType     = "recall"      //召回ID -> 召回记录
+	foodRecallObjectType = "food~recall" //食品 -> 所属召回
+)
+
+//召回等级，I级最严重
+var recallSeverities = map[string]bool{"I": true, "II": true, "III": true}
+
+// Config 链码配置，实例化时以JSON参数传入
+type Config struct {
+	RegulatorMSP     string   `json:"RegulatorMSP"`     //监管机构组织
+	ManufacturerMSPs []string `json:"ManufacturerMSPs"` //可录入生产信息的生产商组织，为空时由RoleAttribute判断
+	LogisticsMSPs    []string `json:"LogisticsMSPs"`    //可录入物流信息的物流组织，为空时由RoleAttribute判断
+	RoleAttribute    string   `json:"RoleAttribute"`    //证书中的角色属性名，设置后其值须为manufacturer或logistics；与组织列表均未配置时拒绝该角色
+}
+
+//保质期索引的复合键对象类型
+const (
+	mfrExpIndex    = "mfrexp~food"    //生产商名称、保质期 -> 食品
+	sellerExpIndex = "sellerexp~food" //销售商、保质期 -> 食品
+)
+
+// ExpiringFood 临期食品
+type ExpiringFood struct {
+	FoodID       string `json:"FoodID"`
+	FoodName     string `json:"FoodName"`
+	FoodLOT      string `json:"FoodLOT"`
+	FoodEXPDate  string `json:"FoodEXPDate"`
+	FoodMFRSName string `json:"FoodMFRSName"`
+}
+
+//许可证的复合键对象类型
+const licenceObjectType = "licence"
+
+// Licence 食品生产许可证，由监管机构维护
+type Licence struct {
+	LicenceNo    string   `json:"LicenceNo"`    //许可证编号，对应FoodQSID
+	Holder       string   `json:"Holder"`       //持证生产商名称，对应FoodMFRSName
+	HolderMSP    string   `json:"HolderMSP"`    //持证生产商组织，为空时不校验
+	Scope        []string `json:"Scope"`        //许可生产的食品名称，为空时不限制
+	ValidFrom    string   `json:"ValidFrom"`    //有效期开始
+	ValidTo      string   `json:"ValidTo"`      //有效期结束
+	Revoked      bool     `json:"Revoked"`      //是否已吊销
+	RevokedAt    string   `json:"RevokedAt"`    //吊销时间
+	RevokeReason string   `json:"RevokeReason"` //吊销原因
+	IssuedBy     string   `json:"IssuedBy"`     //登记的监管组织
+}
+
+//供应链角色
+const (
+	roleManufacturer = "manufacturer"
+	roleLogistics    = "logistics"
+)
+
+// Recall 召回记录
+type Recall struct {
+	RecallID    string   `json:"RecallID"`    //召回ID，取发起交易ID
+	TargetType  string   `json:"TargetType"`  //召回对象类型（lot或ingredient）
+	TargetID    string   `json:"TargetID"`    //批次号或配料ID
+	Reason      string   `json:"Reason"`      //召回原因
+	Severity    string   `json:"Severity"`    //召回等级
+	InitiatedBy string   `json:"InitiatedBy"` //发起组织
+	InitiatedAt string   `json:"InitiatedAt"` //发起时间
+	FoodIDs     []string `json:"FoodIDs"`     //受影响的全部食品
+}
+
+// FoodRecall 单个食品的召回状态
+type FoodRecall struct {
+	FoodID   string `json:"FoodID"`
+	RecallID string `json:"RecallID"`
+	Reason   string `json:"Reason"`
+	Severity string `json:"Severity"`
+}
+
+//追溯默认深度和最大深度
+const (
+	defaultTraceDepth = 5
+	maxTraceDepth     = 20
+)
+
+// TraceNode 追溯树节点
+type TraceNode struct {
+	FoodID    string       `json:"FoodID,omitempty"`
+	FoodName  string       `json:"FoodName,omitempty"`
+	FoodLOT   string       `json:"FoodLOT,omitempty"`
+	IngID     string       `json:"IngID,omitempty"`     //经由的配料ID
+	IngName   string       `json:"IngName,omitempty"`   //经由的配料名称
+	Children  []*TraceNode `json:"Children,omitempty"`  //上游追溯为配料来源，下游追溯为使用方
+	Truncated bool         `json:"Truncated,omitempty"` //达到深度限制，仍有未展开的节点
+	Cycle     bool         `json:"Cycle,omitempty"`     //在当前路径上重复出现，不再展开
+}
+
+//冷链记录的复合键对象类型
+const (
+	profileObjectType = "profile"     //生产商组织、食品名称 -> 产品温湿度范围
+	sensorObjectType  = "food~sensor" //食品、物流序号、交易ID -> 一批传感器读数
+)
+
+//单次上传的最大读数条数
+const maxSensorReadings = 1000
+
+//食品规格中的温湿度范围，如"500g;temp:2~8;humidity:40~60"
+var specRangeRegexp = regexp.MustCompile(`(temp|humidity):(-?\d+(?:\.\d+)?)~(-?\d+(?:\.\d+)?)`)
+
+// SensorRange 温湿度允许范围，未设置的上下限不检查
+type SensorRange struct {
+	TempMin     *float64 `json:"TempMin,omitempty"`     //最低温度
+	TempMax     *float64 `json:"TempMax,omitempty"`     //最高温度
+	HumidityMin *float64 `json:"HumidityMin,omitempty"` //最低湿度
+	HumidityMax *float64 `json:"HumidityMax,omitempty"` //最高湿度
+}
+
+// SensorReading 传感器读数
+type SensorReading struct {
+	SensorID string   `json:"SensorID"`           //传感器ID
+	Time     string   `json:"Time"`               //读数时间，RFC3339格式
+	Temp     *float64 `json:"Temp,omitempty"`     //温度
+	Humidity *float64 `json:"Humidity,omitempty"` //湿度
+}
+
+// Excursion 超出允许范围的读数
+type Excursion struct {
+	SensorID string  `json:"SensorID"`
+	Time     string  `json:"Time"`
+	Metric   string  `json:"Metric"` //temperature或humidity
+	Value    float64 `json:"Value"`
+	Limit    float64 `json:"Limit"` //被突破的上限或下限
+}
+
+// SensorBatch 一次上传的传感器读数及检测出的超限
+type SensorBatch struct {
+	FoodID     string          `json:"FoodID"`
+	LogSeq     int             `json:"LogSeq"` //对应的物流信息序号
+	Writer     *Writer         `json:"Writer"`
+	TxID       string          `json:"TxID"`
+	Range      SensorRange     `json:"Range"` //检测时使用的允许范围
+	Readings   []SensorReading `json:"Readings"`
+	Excursions []Excursion     `json:"Excursions"`
+}
+
+// ShipmentSummary 单段物流的冷链超限汇总
+type ShipmentSummary struct {
+	LogSeq         int         `json:"LogSeq"`
+	LogDeparturePl string      `json:"LogDeparturePl"`
+	LogDest        string      `json:"LogDest"`
+	LogCopName     string      `json:"LogCopName"`
+	InTransit      bool        `json:"InTransit"`      //已发货尚未收货
+	Readings       int         `json:"Readings"`       //读数条数
+	ExcursionCount int         `json:"ExcursionCount"` //超限条数
+	TempMin        *float64    `json:"TempMin,omitempty"`
+	TempMax        *float64    `json:"TempMax,omitempty"`
+	Excursions     []Excursion `json:"Excursions"`
+}
+
+// MigrateResult 旧数据迁移结果
+type MigrateResult struct {
+	FoodID  string `json:"FoodID"`
+	ProInfo bool   `json:"ProInfo"` //是否迁移了生产信息
+	IngInfo bool   `json:"IngInfo"` //是否迁移了配料信息
+	LogInfo int    `json:"LogInfo"` //迁移的物流信息条数
 }
 
 func (a *FoodChainCode) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	//可选参数为Config的JSON
+	_, args := stub.GetFunctionAndParameters()
+	if len(args) == 0 {
+		return shim.Success(nil)
+	}
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments.")
+	}
+	var config Config
+	if err := json.Unmarshal([]byte(args[0]), &config); err != nil {
+		return shim.Error(err.Error())
+	}
+	ConfigAsBytes, err := json.Marshal(config)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = stub.PutState("config", ConfigAsBytes); err != nil {
+		return shim.Error(err.Error())
+	}
 	return shim.Success(nil)
 }
 func (a *FoodChainCode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
@@ -65,8 +323,14 @@ func (a *FoodChainCode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 		return addIngInfo(stub, args)
 	case "getFoodInfo":
 		return getFoodInfo(stub, args)
-	case "addLogInfo":
-		return addLogInfo(stub, args)
+	case "shipFood":
+		return shipFood(stub, args)
+	case "receiveFood":
+		return receiveFood(stub, args)
+	case "getShipment":
+		return getShipment(stub, args)
+	case "validateChain":
+		return validateChain(stub, args)
 	case "getProInfo":
 		return getProInfo(stub, args)
 	case "getLogInfo":
@@ -75,11 +339,428 @@ func (a *FoodChainCode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 		return getIngInfo(stub, args)
 	case "getLogInfo_1":
 		return getLogInfo_1(stub, args)
+	case "traceUpstream":
+		return traceUpstream(stub, args)
+	case "traceDownstream":
+		return traceDownstream(stub, args)
+	case "initiateRecall":
+		return initiateRecall(stub, args)
+	case "getRecall":
+		return getRecall(stub, args)
+	case "getFoodRecall":
+		return getFoodRecall(stub, args)
+	case "setProductProfile":
+		return setProductProfile(stub, args)
+	case "addSensorReadings":
+		return addSensorReadings(stub, args)
+	case "getExcursionSummary":
+		return getExcursionSummary(stub, args)
+	case "getExpiringFoods":
+		return getExpiringFoods(stub, args)
+	case "getTraceSummary":
+		return getTraceSummary(stub, args)
+	case "registerLicence":
+		return registerLicence(stub, args)
+	case "revokeLicence":
+		return revokeLicence(stub, args)
+	case "getLicence":
+		return getLicence(stub, args)
+	case "assignManufacturer":
+		return assignManufacturer(stub, args)
+	case "migrateFoodInfo":
+		return migrateFoodInfo(stub, args)
 
 	}
 	return shim.Error(fmt.Sprintf("unsupported function: %s", fn))
 }
 
+//读取生产信息，不存在时返回nil
+func readProInfo(stub shim.ChaincodeStubInterface, FoodID string) (*ProInfo, error) {
+	key, err := stub.CreateCompositeKey(proObjectType, []string{FoodID})
+	if err != nil {
+		return nil, err
+	}
+	ProInfoAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if ProInfoAsBytes == nil {
+		return nil, nil
+	}
+	var foodProInfo ProInfo
+	if err = json.Unmarshal(ProInfoAsBytes, &foodProInfo); err != nil {
+		return nil, err
+	}
+	return &foodProInfo, nil
+}
+
+//保存生产信息，同时维护批次号索引
+func writeProInfo(stub shim.ChaincodeStubInterface, FoodID string, foodProInfo ProInfo) error {
+	oldProInfo, err := readProInfo(stub, FoodID)
+	if err != nil {
+		return err
+	}
+	if oldProInfo != nil && oldProInfo.FoodLOT != foodProInfo.FoodLOT {
+		if err = delIndex(stub, lotIndex, oldProInfo.FoodLOT, FoodID); err != nil {
+			return err
+		}
+	}
+	if err = putIndex(stub, lotIndex, foodProInfo.FoodLOT, FoodID); err != nil {
+		return err
+	}
+	//保质期索引：生产商和当前销售商
+	LogInfos, err := readLogInfos(stub, FoodID)
+	if err != nil {
+		return err
+	}
+	var seller string
+	if len(LogInfos) > 0 {
+		seller = LogInfos[len(LogInfos)-1].LogToSeller
+	}
+	if oldProInfo != nil {
+		if err = writeExpiryIndex(stub, mfrExpIndex, oldProInfo.FoodMFRSName, FoodID, oldProInfo, true); err != nil {
+			return err
+		}
+		if err = writeExpiryIndex(stub, sellerExpIndex, seller, FoodID, oldProInfo, true); err != nil {
+			return err
+		}
+	}
+	if err = writeExpiryIndex(stub, mfrExpIndex, foodProInfo.FoodMFRSName, FoodID, &foodProInfo, false); err != nil {
+		return err
+	}
+	if err = writeExpiryIndex(stub, sellerExpIndex, seller, FoodID, &foodProInfo, false); err != nil {
+		return err
+	}
+	key, err := stub.CreateCompositeKey(proObjectType, []string{FoodID})
+	if err != nil {
+		return err
+	}
+	ProInfoAsBytes, err := json.Marshal(foodProInfo)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, ProInfoAsBytes)
+}
+
+//读取配料信息，不存在时返回nil
+func readIngInfo(stub shim.ChaincodeStubInterface, FoodID string) ([]IngInfo, error) {
+	key, err := stub.CreateCompositeKey(ingObjectType, []string{FoodID})
+	if err != nil {
+		return nil, err
+	}
+	IngInfoAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if IngInfoAsBytes == nil {
+		return nil, nil
+	}
+	var foodIngInfo []IngInfo
+	if err = json.Unmarshal(IngInfoAsBytes, &foodIngInfo); err != nil {
+		return nil, err
+	}
+	return foodIngInfo, nil
+}
+
+//保存配料信息，整体替换原有配料列表，同时维护上游食品和批次索引
+func writeIngInfo(stub shim.ChaincodeStubInterface, FoodID string, foodIngInfo []IngInfo) error {
+	oldIngInfo, err := readIngInfo(stub, FoodID)
+	if err != nil {
+		return err
+	}
+	for _, IngInfoitem := range oldIngInfo {
+		if err = delIndex(stub, ingIndex, IngInfoitem.IngFoodID, FoodID); err != nil {
+			return err
+		}
+		if err = delIndex(stub, ingLotIndex, IngInfoitem.IngLOT, FoodID); err != nil {
+			return err
+		}
+		if err = delIndex(stub, ingIDIndex, IngInfoitem.IngID, FoodID); err != nil {
+			return err
+		}
+	}
+	for _, IngInfoitem := range foodIngInfo {
+		if err = putIndex(stub, ingIndex, IngInfoitem.IngFoodID, FoodID); err != nil {
+			return err
+		}
+		if err = putIndex(stub, ingLotIndex, IngInfoitem.IngLOT, FoodID); err != nil {
+			return err
+		}
+		if err = putIndex(stub, ingIDIndex, IngInfoitem.IngID, FoodID); err != nil {
+			return err
+		}
+	}
+	key, err := stub.CreateCompositeKey(ingObjectType, []string{FoodID})
+	if err != nil {
+		return err
+	}
+	IngInfoAsBytes, err := json.Marshal(foodIngInfo)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, IngInfoAsBytes)
+}
+
+//写入索引，属性为空时忽略
+func putIndex(stub shim.ChaincodeStubInterface, index, attr, FoodID string) error {
+	if attr == "" {
+		return nil
+	}
+	key, err := stub.CreateCompositeKey(index, []string{attr, FoodID})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, []byte{0x00})
+}
+
+//删除索引，属性为空时忽略
+func delIndex(stub shim.ChaincodeStubInterface, index, attr, FoodID string) error {
+	if attr == "" {
+		return nil
+	}
+	key, err := stub.CreateCompositeKey(index, []string{attr, FoodID})
+	if err != nil {
+		return err
+	}
+	return stub.DelState(key)
+}
+
+//解析日期，支持2006-01-02和RFC3339格式
+func parseFoodDate(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, fmt.Errorf("invalid date %s, expecting 2006-01-02 or RFC3339", value)
+	}
+	return t, nil
+}
+
+//解析保质期，仅有日期时当天全天有效
+func parseExpiry(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t.AddDate(0, 0, 1), nil
+	}
+	return parseFoodDate(value)
+}
+
+//获取交易时间
+func getTxTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).UTC(), nil
+}
+
+//写入或删除保质期索引，保质期无法解析的旧数据不建索引
+func writeExpiryIndex(stub shim.ChaincodeStubInterface, index, name, FoodID string, foodProInfo *ProInfo, remove bool) error {
+	if name == "" {
+		return nil
+	}
+	expDate, err := parseExpiry(foodProInfo.FoodEXPDate)
+	if err != nil {
+		return nil
+	}
+	key, err := stub.CreateCompositeKey(index, []string{name, expDate.UTC().Format(time.RFC3339), FoodID})
+	if err != nil {
+		return err
+	}
+	if remove {
+		return stub.DelState(key)
+	}
+	return stub.PutState(key, []byte{0x00})
+}
+
+//检查食品是否已过保质期，保质期无法解析的旧数据不检查
+func checkNotExpired(stub shim.ChaincodeStubInterface, FoodID string, foodProInfo *ProInfo) error {
+	if foodProInfo == nil {
+		return nil
+	}
+	expDate, err := parseExpiry(foodProInfo.FoodEXPDate)
+	if err != nil {
+		return nil
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+	if !now.Before(expDate) {
+		return fmt.Errorf("FoodID %s expired on %s", FoodID, foodProInfo.FoodEXPDate)
+	}
+	return nil
+}
+
+//按索引查询食品ID
+func queryIndex(stub shim.ChaincodeStubInterface, index, attr string) ([]string, error) {
+	resultIterator, err := stub.GetStateByPartialCompositeKey(index, []string{attr})
+	if err != nil {
+		return nil, err
+	}
+	defer resultIterator.Close()
+
+	var FoodIDs []string
+	for resultIterator.HasNext() {
+		response, err := resultIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attrs, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, err
+		}
+		FoodIDs = append(FoodIDs, attrs[1])
+	}
+	return FoodIDs, nil
+}
+
+//按顺序读取全部物流信息
+func readLogInfos(stub shim.ChaincodeStubInterface, FoodID string) ([]LogInfo, error) {
+	resultIterator, err := stub.GetStateByPartialCompositeKey(logObjectType, []string{FoodID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultIterator.Close()
+
+	var LogInfos []LogInfo
+	for resultIterator.HasNext() {
+		response, err := resultIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var LogInfo LogInfo
+		if err = json.Unmarshal(response.Value, &LogInfo); err != nil {
+			return nil, err
+		}
+		LogInfos = append(LogInfos, LogInfo)
+	}
+	return LogInfos, nil
+}
+
+//追加一条物流信息，序号为已有条数
+func appendLogInfo(stub shim.ChaincodeStubInterface, FoodID string, seq int, foodLogInfo LogInfo) error {
+	key, err := stub.CreateCompositeKey(logObjectType, []string{FoodID, fmt.Sprintf("%010d", seq)})
+	if err != nil {
+		return err
+	}
+	LogInfoAsBytes, err := json.Marshal(foodLogInfo)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, LogInfoAsBytes)
+}
+
+//解析存储时间，支持小时数或Go时长格式（如36h、90m），为空时为0
+func parseStorageTm(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if hours, err := strconv.ParseFloat(value, 64); err == nil && hours >= 0 {
+		return time.Duration(hours * float64(time.Hour)), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid storage time %s, expecting hours or a duration like 36h", value)
+	}
+	return d, nil
+}
+
+//校验一条物流信息及其与上一条物流信息的连续性，返回全部异常
+//到达时间为空表示尚未收货，只校验出发信息
+func checkLogChain(LogSeq int, prev, cur *LogInfo) []ChainAnomaly {
+	var anomalies []ChainAnomaly
+	report := func(field, format string, a ...interface{}) {
+		anomalies = append(anomalies, ChainAnomaly{LogSeq: LogSeq, Field: field, Detail: fmt.Sprintf(format, a...)})
+	}
+	departureTm, depErr := time.Parse(time.RFC3339, cur.LogDepartureTm)
+	if depErr != nil {
+		report("LogDepartureTm", "%s is not RFC3339", cur.LogDepartureTm)
+	}
+	if cur.LogArrivalTm != "" {
+		arrivalTm, err := time.Parse(time.RFC3339, cur.LogArrivalTm)
+		if err != nil {
+			report("LogArrivalTm", "%s is not RFC3339", cur.LogArrivalTm)
+		} else if depErr == nil && arrivalTm.Before(departureTm) {
+			report("LogArrivalTm", "arrived at %s before departure at %s", cur.LogArrivalTm, cur.LogDepartureTm)
+		}
+		if _, err = parseStorageTm(cur.LogStorageTm); err != nil {
+			report("LogStorageTm", "%s", err.Error())
+		}
+	}
+	if prev == nil {
+		return anomalies
+	}
+	if cur.LogDeparturePl != prev.LogDest {
+		report("LogDeparturePl", "departed from %s but previous leg arrived at %s", cur.LogDeparturePl, prev.LogDest)
+	}
+	//上一条物流信息的到达时间加存储时间不能晚于本次出发时间
+	prevArrivalTm, err := time.Parse(time.RFC3339, prev.LogArrivalTm)
+	if err != nil || depErr != nil {
+		return anomalies
+	}
+	if departureTm.Before(prevArrivalTm) {
+		report("LogDepartureTm", "departed at %s before previous leg arrived at %s", cur.LogDepartureTm, prev.LogArrivalTm)
+	} else if storageTm, err := parseStorageTm(prev.LogStorageTm); err == nil && departureTm.Before(prevArrivalTm.Add(storageTm)) {
+		report("LogStorageTm", "previous leg stored %s from %s, overlapping departure at %s", prev.LogStorageTm, prev.LogArrivalTm, cur.LogDepartureTm)
+	}
+	return anomalies
+}
+
+//将异常合并为错误
+func anomaliesError(anomalies []ChainAnomaly) error {
+	if len(anomalies) == 0 {
+		return nil
+	}
+	details := make([]string, 0, len(anomalies))
+	for _, anomaly := range anomalies {
+		details = append(details, anomaly.Field+": "+anomaly.Detail)
+	}
+	return fmt.Errorf("invalid logistics record: %s", strings.Join(details, "; "))
+}
+
+//读取在途的物流信息，不存在时返回nil
+func readShipment(stub shim.ChaincodeStubInterface, FoodID string) (*Shipment, error) {
+	key, err := stub.CreateCompositeKey(shipmentObjectType, []string{FoodID})
+	if err != nil {
+		return nil, err
+	}
+	ShipmentAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if ShipmentAsBytes == nil {
+		return nil, nil
+	}
+	var shipment Shipment
+	if err = json.Unmarshal(ShipmentAsBytes, &shipment); err != nil {
+		return nil, err
+	}
+	return &shipment, nil
+}
+
+//保存在途的物流信息
+func writeShipment(stub shim.ChaincodeStubInterface, shipment *Shipment) ([]byte, error) {
+	key, err := stub.CreateCompositeKey(shipmentObjectType, []string{shipment.FoodID})
+	if err != nil {
+		return nil, err
+	}
+	ShipmentAsBytes, err := json.Marshal(shipment)
+	if err != nil {
+		return nil, err
+	}
+	return ShipmentAsBytes, stub.PutState(key, ShipmentAsBytes)
+}
+
+//删除在途的物流信息
+func deleteShipment(stub shim.ChaincodeStubInterface, FoodID string) error {
+	key, err := stub.CreateCompositeKey(shipmentObjectType, []string{FoodID})
+	if err != nil {
+		return err
+	}
+	return stub.DelState(key)
+}
+
 //新增生产函数
 func addProInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	var err error
@@ -88,279 +769,1785 @@ func addProInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) != 10 {
 		return shim.Error("Incorrect number of arguments.")
 	}
-	//参数解析
-	FoodInfos.FoodID = args[0]
-	if FoodInfos.FoodID == "" {
-		return shim.Error("FoodID can not be empty")
+	//参数解析
+	FoodInfos.FoodID = args[0]
+	if FoodInfos.FoodID == "" {
+		return shim.Error("FoodID can not be empty")
+	}
+	FoodInfos.FoodProInfo.FoodName = args[1]
+	FoodInfos.FoodProInfo.FoodSpec = args[2]
+	FoodInfos.FoodProInfo.FoodMFGDate = args[3]
+	FoodInfos.FoodProInfo.FoodEXPDate = args[4]
+	FoodInfos.FoodProInfo.FoodLOT = args[5]
+	FoodInfos.FoodProInfo.FoodQSID = args[6]
+	FoodInfos.FoodProInfo.FoodMFRSName = args[7]
+	FoodInfos.FoodProInfo.FoodProPrice = args[8]
+	FoodInfos.FoodProInfo.FoodProPlace = args[9]
+	MFGDate, err := parseFoodDate(FoodInfos.FoodProInfo.FoodMFGDate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	EXPDate, err := parseFoodDate(FoodInfos.FoodProInfo.FoodEXPDate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if EXPDate.Before(MFGDate) {
+		return shim.Error("FoodEXPDate can not be before FoodMFGDate")
+	}
+	//权限校验：生产商角色，已存在的生产信息只能由原生产商修改
+	FoodInfos.FoodProInfo.Writer, err = checkRole(stub, roleManufacturer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	FoodInfos.FoodProInfo.FoodMFRSMSP = FoodInfos.FoodProInfo.Writer.MSPID
+	oldProInfo, err := readProInfo(stub, FoodInfos.FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if oldProInfo != nil {
+		if err = checkFoodOwner(FoodInfos.FoodID, oldProInfo, FoodInfos.FoodProInfo.FoodMFRSMSP); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if err = checkLicence(stub, &FoodInfos.FoodProInfo); err != nil {
+		return shim.Error(err.Error())
+	}
+	//保存状态
+	err = writeProInfo(stub, FoodInfos.FoodID, FoodInfos.FoodProInfo)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+//新增配料信息
+func addIngInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var FoodInfos FoodInfo
+	var IngInfoitem IngInfo
+	//参数为FoodID加IngInfo的JSON数组时，配料可引用上游食品ID和批次号
+	if len(args) == 2 && strings.HasPrefix(strings.TrimSpace(args[1]), "[") {
+		if err := json.Unmarshal([]byte(args[1]), &FoodInfos.FoodIngInfo); err != nil {
+			return shim.Error(err.Error())
+		}
+	} else {
+		//判断参数合法性
+		if (len(args)-1)%2 != 0 || len(args) == 1 {
+			return shim.Error("Incorrect number of arguments.")
+		}
+		//参数解析
+		for i := 1; i < len(args); {
+			IngInfoitem.IngID = args[i]
+			IngInfoitem.IngName = args[i+1]
+			FoodInfos.FoodIngInfo = append(FoodInfos.FoodIngInfo, IngInfoitem)
+			i = i + 2
+		}
+	}
+	FoodID := args[0]
+	if FoodID == "" {
+		return shim.Error("FoodID can not be empty")
+	}
+	//校验引用的上游食品
+	for _, IngInfoitem := range FoodInfos.FoodIngInfo {
+		if IngInfoitem.IngFoodID == "" {
+			continue
+		}
+		if IngInfoitem.IngFoodID == FoodID {
+			return shim.Error("ingredient can not reference the food itself")
+		}
+		IngProInfo, err := readProInfo(stub, IngInfoitem.IngFoodID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if IngProInfo == nil {
+			return shim.Error(fmt.Sprintf("ingredient food %s not found", IngInfoitem.IngFoodID))
+		}
+		if IngInfoitem.IngLOT != "" && IngInfoitem.IngLOT != IngProInfo.FoodLOT {
+			return shim.Error(fmt.Sprintf("ingredient food %s is not in lot %s", IngInfoitem.IngFoodID, IngInfoitem.IngLOT))
+		}
+	}
+	FoodInfos.FoodID = FoodID
+	//权限校验：只有生产该食品的生产商可以修改配料
+	writer, err := checkManufacturer(stub, FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for i := range FoodInfos.FoodIngInfo {
+		FoodInfos.FoodIngInfo[i].Writer = writer
+	}
+	//状态保存
+	err = writeIngInfo(stub, FoodInfos.FoodID, FoodInfos.FoodIngInfo)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+//获取食品全部信息
+func getFoodInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//检查参数个数
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments.")
+	}
+	//参数解析
+	FoodID := args[0]
+	//在世界状态中根据FoodID直接读取各类记录
+	var foodAllinfo FoodAllInfo
+	foodAllinfo.FoodID = FoodID
+	foodProInfo, err := readProInfo(stub, FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if foodProInfo != nil {
+		foodAllinfo.FoodProInfo = *foodProInfo
+	}
+	foodAllinfo.FoodIngInfo, err = readIngInfo(stub, FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	foodAllinfo.FoodLogInfo, err = readLogInfos(stub, FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//对结果进行序列化
+	jsonAsBytes, err := json.Marshal(foodAllinfo)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//运行成功并返回
+	return shim.Success(jsonAsBytes)
+}
+
+//发货，由发货方录入物流信息并指定收货方组织，收货方确认后物流信息才生效
+func shipFood(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+	var shipment Shipment
+	//判断参数合法性并解析参数
+	if len(args) != 12 {
+		return shim.Error("Incorrect number of arguments.")
+	}
+	shipment.FoodID = args[0]
+	if shipment.FoodID == "" {
+		return shim.Error("FoodID can not be empty")
+	}
+	shipment.FoodLogInfo.LogDepartureTm = args[1]
+	shipment.FoodLogInfo.LogMission = args[2]
+	shipment.FoodLogInfo.LogDeparturePl = args[3]
+	shipment.FoodLogInfo.LogDest = args[4]
+	shipment.FoodLogInfo.LogToSeller = args[5]
+	shipment.FoodLogInfo.LogMOT = args[6]
+	shipment.FoodLogInfo.LogCopName = args[7]
+	shipment.FoodLogInfo.LogCost = args[8]
+	shipment.FoodLogInfo.Quantity = args[9]
+	shipment.ReceiverMSP = args[10]
+	shipment.ExpectedArrivalTm = args[11]
+	if shipment.ReceiverMSP == "" {
+		return shim.Error("ReceiverMSP can not be empty")
+	}
+	if _, err = strconv.ParseFloat(shipment.FoodLogInfo.Quantity, 64); err != nil {
+		return shim.Error("Quantity must be a number")
+	}
+	if _, err = time.Parse(time.RFC3339, shipment.ExpectedArrivalTm); err != nil {
+		return shim.Error(fmt.Sprintf("ExpectedArrivalTm %s is not RFC3339", shipment.ExpectedArrivalTm))
+	}
+	//权限校验：物流角色
+	shipment.FoodLogInfo.Writer, err = checkRole(stub, roleLogistics)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//已召回的食品不能继续运输
+	foodRecall, err := readFoodRecall(stub, shipment.FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if foodRecall != nil {
+		return shim.Error(fmt.Sprintf("FoodID %s has been recalled: %s", shipment.FoodID, foodRecall.Reason))
+	}
+	//过期食品不能继续运输和销售
+	foodProInfo, err := readProInfo(stub, shipment.FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if foodProInfo == nil {
+		return shim.Error(fmt.Sprintf("FoodID %s not found", shipment.FoodID))
+	}
+	if err = checkNotExpired(stub, shipment.FoodID, foodProInfo); err != nil {
+		return shim.Error(err.Error())
+	}
+	//同一时间只能有一批在途
+	oldShipment, err := readShipment(stub, shipment.FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if oldShipment != nil {
+		return shim.Error(fmt.Sprintf("FoodID %s is already in transit to %s", shipment.FoodID, oldShipment.ReceiverMSP))
+	}
+	//只有当前保管方可以发货：上一环节已由收货方确认时为收货方，否则为生产商
+	LogInfos, err := readLogInfos(stub, shipment.FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var prev *LogInfo
+	if len(LogInfos) > 0 {
+		prev = &LogInfos[len(LogInfos)-1]
+	}
+	holder := foodProInfo.FoodMFRSMSP
+	if prev != nil && prev.Receiver != nil {
+		holder = prev.Receiver.MSPID
+	}
+	if holder == "" {
+		return shim.Error(fmt.Sprintf("FoodID %s has no owning manufacturer, the regulator must assign one first", shipment.FoodID))
+	}
+	if holder != shipment.FoodLogInfo.Writer.MSPID {
+		return shim.Error(fmt.Sprintf("FoodID %s is held by %s", shipment.FoodID, holder))
+	}
+	//出发地、出发时间须与上一条物流信息衔接
+	if err = anomaliesError(checkLogChain(len(LogInfos), prev, &shipment.FoodLogInfo)); err != nil {
+		return shim.Error(err.Error())
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	shipment.ShippedAt = now.Format(time.RFC3339)
+	shipment.FoodLogInfo.ShipTxID = stub.GetTxID()
+	//保存状态
+	ShipmentAsBytes, err := writeShipment(stub, &shipment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(ShipmentAsBytes)
+}
+
+//收货，由发货时指定的收货方组织确认，记录到达信息和差异后写入物流信息
+func receiveFood(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//判断参数合法性并解析参数
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments.")
+	}
+	FoodID := args[0]
+	shipment, err := readShipment(stub, FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if shipment == nil {
+		return shim.Error(fmt.Sprintf("FoodID %s is not in transit", FoodID))
+	}
+	FoodLogInfo := shipment.FoodLogInfo
+	FoodLogInfo.LogArrivalTm = args[1]
+	FoodLogInfo.LogStorageTm = args[2]
+	FoodLogInfo.ReceivedQuantity = args[3]
+	damage := args[4]
+	if FoodLogInfo.LogArrivalTm == "" {
+		return shim.Error("LogArrivalTm can not be empty")
+	}
+	received, err := strconv.ParseFloat(FoodLogInfo.ReceivedQuantity, 64)
+	if err != nil {
+		return shim.Error("ReceivedQuantity must be a number")
+	}
+	//权限校验：物流角色，且为指定的收货方，不能由发货方本人确认
+	FoodLogInfo.Receiver, err = checkRole(stub, roleLogistics)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if FoodLogInfo.Receiver.MSPID != shipment.ReceiverMSP {
+		return shim.Error(fmt.Sprintf("only %s can receive FoodID %s", shipment.ReceiverMSP, FoodID))
+	}
+	if FoodLogInfo.Writer != nil && FoodLogInfo.Writer.ID == FoodLogInfo.Receiver.ID {
+		return shim.Error("sender can not receive its own shipment")
+	}
+	//以已有物流信息条数作为新记录的序号，到达信息须与出发信息和上一条物流信息衔接
+	LogInfos, err := readLogInfos(stub, FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var prev *LogInfo
+	if len(LogInfos) > 0 {
+		prev = &LogInfos[len(LogInfos)-1]
+	}
+	if err = anomaliesError(checkLogChain(len(LogInfos), prev, &FoodLogInfo)); err != nil {
+		return shim.Error(err.Error())
+	}
+	arrivalTm, _ := time.Parse(time.RFC3339, FoodLogInfo.LogArrivalTm)
+	//记录差异
+	shipped, _ := strconv.ParseFloat(FoodLogInfo.Quantity, 64)
+	if received != shipped {
+		FoodLogInfo.Discrepancies = append(FoodLogInfo.Discrepancies, Discrepancy{
+			Type:   discrepancyQuantity,
+			Detail: fmt.Sprintf("shipped %s, received %s", FoodLogInfo.Quantity, FoodLogInfo.ReceivedQuantity),
+		})
+	}
+	if damage != "" {
+		FoodLogInfo.Discrepancies = append(FoodLogInfo.Discrepancies, Discrepancy{Type: discrepancyDamage, Detail: damage})
+	}
+	if expectedTm, err := time.Parse(time.RFC3339, shipment.ExpectedArrivalTm); err == nil && arrivalTm.After(expectedTm) {
+		FoodLogInfo.Discrepancies = append(FoodLogInfo.Discrepancies, Discrepancy{
+			Type:   discrepancyLate,
+			Detail: fmt.Sprintf("expected %s, arrived %s", shipment.ExpectedArrivalTm, FoodLogInfo.LogArrivalTm),
+		})
+	}
+	//在途期间被召回或过期的食品仍需收货，以便确定保管方，召回和过期状态由查询接口体现
+	foodProInfo, err := readProInfo(stub, FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//销售商变更时更新保质期索引
+	if foodProInfo != nil {
+		var seller string
+		if prev != nil {
+			seller = prev.LogToSeller
+		}
+		if seller != FoodLogInfo.LogToSeller {
+			if err = writeExpiryIndex(stub, sellerExpIndex, seller, FoodID, foodProInfo, true); err != nil {
+				return shim.Error(err.Error())
+			}
+			if err = writeExpiryIndex(stub, sellerExpIndex, FoodLogInfo.LogToSeller, FoodID, foodProInfo, false); err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+	}
+	//保存状态
+	if err = appendLogInfo(stub, FoodID, len(LogInfos), FoodLogInfo); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = deleteShipment(stub, FoodID); err != nil {
+		return shim.Error(err.Error())
+	}
+	LogInfoAsBytes, err := json.Marshal(FoodLogInfo)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(LogInfoAsBytes)
+}
+
+//校验食品物流链的连续性，返回全部物流信息（含在途）的异常，无异常时返回空数组
+func validateChain(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments.")
+	}
+	FoodID := args[0]
+	LogInfos, err := readLogInfos(stub, FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	shipment, err := readShipment(stub, FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if shipment != nil {
+		LogInfos = append(LogInfos, shipment.FoodLogInfo)
+	}
+	anomalies := make([]ChainAnomaly, 0)
+	for i := range LogInfos {
+		var prev *LogInfo
+		if i > 0 {
+			prev = &LogInfos[i-1]
+		}
+		anomalies = append(anomalies, checkLogChain(i, prev, &LogInfos[i])...)
+	}
+	jsonAsBytes, err := json.Marshal(anomalies)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(jsonAsBytes)
+}
+
+//获取在途的物流信息
+func getShipment(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments.")
+	}
+	shipment, err := readShipment(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if shipment == nil {
+		return shim.Error(fmt.Sprintf("FoodID %s is not in transit", args[0]))
+	}
+	jsonAsBytes, err := json.Marshal(shipment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(jsonAsBytes)
+}
+
+//获取食品基本生产信息
+func getProInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//判断参数合法性并解析参数
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments.")
+	}
+	FoodID := args[0]
+	//根据FoodID查询信息
+	var foodProInfo ProInfo
+	ProInfoPtr, err := readProInfo(stub, FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if ProInfoPtr != nil {
+		foodProInfo = *ProInfoPtr
+	}
+	//对结果进行序列化
+	jsonAsBytes, err := json.Marshal(foodProInfo)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//返回
+	return shim.Success(jsonAsBytes)
+}
+
+//获取配料信息
+func getIngInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments.")
+	}
+	FoodID := args[0]
+	foodIngInfo, err := readIngInfo(stub, FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	jsonAsBytes, err := json.Marshal(foodIngInfo)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//返回
+	return shim.Success(jsonAsBytes)
+}
+
+//获取全部物流信息
+func getLogInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments.")
+	}
+	FoodID := args[0]
+	LogInfos, err := readLogInfos(stub, FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	jsonAsBytes, err := json.Marshal(LogInfos)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//返回
+	return shim.Success(jsonAsBytes)
+}
+
+//获取最新物流信息
+func getLogInfo_1(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var LogInfo LogInfo
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments.")
+	}
+	FoodID := args[0]
+	LogInfos, err := readLogInfos(stub, FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(LogInfos) > 0 {
+		LogInfo = LogInfos[len(LogInfos)-1]
+	}
+	jsonAsBytes, err := json.Marshal(LogInfo)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//返回
+	return shim.Success(jsonAsBytes)
+}
+
+//解析追溯参数：FoodID和可选的追溯深度
+func parseTraceArgs(args []string) (string, int, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return "", 0, fmt.Errorf("Incorrect number of arguments.")
+	}
+	FoodID := args[0]
+	if FoodID == "" {
+		return "", 0, fmt.Errorf("FoodID can not be empty")
+	}
+	depth := defaultTraceDepth
+	if len(args) == 2 {
+		var err error
+		depth, err = strconv.Atoi(args[1])
+		if err != nil || depth < 0 || depth > maxTraceDepth {
+			return "", 0, fmt.Errorf("depth must be between 0 and %d", maxTraceDepth)
+		}
+	}
+	return FoodID, depth, nil
+}
+
+//创建食品节点，填充生产信息中的名称和批次号
+func newTraceNode(stub shim.ChaincodeStubInterface, FoodID string) (*TraceNode, error) {
+	node := &TraceNode{FoodID: FoodID}
+	foodProInfo, err := readProInfo(stub, FoodID)
+	if err != nil {
+		return nil, err
+	}
+	if foodProInfo != nil {
+		node.FoodName = foodProInfo.FoodName
+		node.FoodLOT = foodProInfo.FoodLOT
+	}
+	return node, nil
+}
+
+//向上游追溯：展开配料引用的食品，仅引用批次号时展开该批次的全部食品
+func traceUp(stub shim.ChaincodeStubInterface, FoodID string, depth int, path map[string]bool) (*TraceNode, error) {
+	node, err := newTraceNode(stub, FoodID)
+	if err != nil {
+		return nil, err
+	}
+	if path[FoodID] {
+		node.Cycle = true
+		return node, nil
+	}
+	foodIngInfo, err := readIngInfo(stub, FoodID)
+	if err != nil {
+		return nil, err
+	}
+	if depth == 0 {
+		node.Truncated = len(foodIngInfo) > 0
+		return node, nil
+	}
+	path[FoodID] = true
+	defer delete(path, FoodID)
+	for _, IngInfoitem := range foodIngInfo {
+		var child *TraceNode
+		if IngInfoitem.IngFoodID != "" {
+			child, err = traceUp(stub, IngInfoitem.IngFoodID, depth-1, path)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			child = &TraceNode{FoodLOT: IngInfoitem.IngLOT}
+			if IngInfoitem.IngLOT != "" {
+				FoodIDs, err := queryIndex(stub, lotIndex, IngInfoitem.IngLOT)
+				if err != nil {
+					return nil, err
+				}
+				for _, LotFoodID := range FoodIDs {
+					LotNode, err := traceUp(stub, LotFoodID, depth-1, path)
+					if err != nil {
+						return nil, err
+					}
+					child.Children = append(child.Children, LotNode)
+				}
+			}
+		}
+		child.IngID = IngInfoitem.IngID
+		child.IngName = IngInfoitem.IngName
+		node.Children = append(node.Children, child)
+	}
+	return node, nil
+}
+
+//查询将该食品或其批次作为配料的食品，去重并排序
+func queryConsumers(stub shim.ChaincodeStubInterface, FoodID, FoodLOT string) ([]string, error) {
+	FoodIDs, err := queryIndex(stub, ingIndex, FoodID)
+	if err != nil {
+		return nil, err
+	}
+	if FoodLOT != "" {
+		LotFoodIDs, err := queryIndex(stub, ingLotIndex, FoodLOT)
+		if err != nil {
+			return nil, err
+		}
+		FoodIDs = append(FoodIDs, LotFoodIDs...)
+	}
+	return uniqueSorted(FoodIDs), nil
+}
+
+//去重并排序，保证结果确定
+func uniqueSorted(FoodIDs []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, FoodID := range FoodIDs {
+		if !seen[FoodID] {
+			seen[FoodID] = true
+			result = append(result, FoodID)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+//向下游追溯：展开将该食品或其批次作为配料的食品
+func traceDown(stub shim.ChaincodeStubInterface, FoodID string, depth int, path map[string]bool) (*TraceNode, error) {
+	node, err := newTraceNode(stub, FoodID)
+	if err != nil {
+		return nil, err
+	}
+	if path[FoodID] {
+		node.Cycle = true
+		return node, nil
+	}
+	consumers, err := queryConsumers(stub, FoodID, node.FoodLOT)
+	if err != nil {
+		return nil, err
+	}
+	if depth == 0 {
+		node.Truncated = len(consumers) > 0
+		return node, nil
+	}
+	path[FoodID] = true
+	defer delete(path, FoodID)
+	for _, ConsumerID := range consumers {
+		child, err := traceDown(stub, ConsumerID, depth-1, path)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, child)
+	}
+	return node, nil
+}
+
+//向上游追溯食品的配料来源，参数为FoodID和可选的追溯深度
+func traceUpstream(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	FoodID, depth, err := parseTraceArgs(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	node, err := traceUp(stub, FoodID, depth, make(map[string]bool))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	jsonAsBytes, err := json.Marshal(node)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(jsonAsBytes)
+}
+
+//向下游追溯使用该食品作为配料的全部食品，参数为FoodID和可选的追溯深度
+func traceDownstream(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	FoodID, depth, err := parseTraceArgs(args)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	node, err := traceDown(stub, FoodID, depth, make(map[string]bool))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	jsonAsBytes, err := json.Marshal(node)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(jsonAsBytes)
+}
+
+//读取链码配置
+func readConfig(stub shim.ChaincodeStubInterface) (*Config, error) {
+	var config Config
+	ConfigAsBytes, err := stub.GetState("config")
+	if err != nil {
+		return nil, err
+	}
+	if ConfigAsBytes != nil {
+		if err = json.Unmarshal(ConfigAsBytes, &config); err != nil {
+			return nil, err
+		}
+	}
+	return &config, nil
+}
+
+//校验调用者是否具有指定供应链角色，返回调用者身份
+func checkRole(stub shim.ChaincodeStubInterface, role string) (*Writer, error) {
+	config, err := readConfig(stub)
+	if err != nil {
+		return nil, err
+	}
+	var writer Writer
+	writer.MSPID, err = cid.GetMSPID(stub)
+	if err != nil {
+		return nil, err
+	}
+	writer.ID, err = cid.GetID(stub)
+	if err != nil {
+		return nil, err
+	}
+	allowed := config.ManufacturerMSPs
+	if role == roleLogistics {
+		allowed = config.LogisticsMSPs
+	}
+	//角色未配置时拒绝，避免未初始化的链码对任意组织开放
+	if len(allowed) == 0 && config.RoleAttribute == "" {
+		return nil, fmt.Errorf("role %s is not configured", role)
+	}
+	if len(allowed) > 0 {
+		found := false
+		for _, mspID := range allowed {
+			if mspID == writer.MSPID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("MSP %s is not allowed to act as %s", writer.MSPID, role)
+		}
+	}
+	if config.RoleAttribute != "" {
+		if err = cid.AssertAttributeValue(stub, config.RoleAttribute, role); err != nil {
+			return nil, fmt.Errorf("caller is not a %s: %s", role, err)
+		}
+	}
+	return &writer, nil
+}
+
+//校验调用者为监管机构，返回监管组织
+func checkRegulator(stub shim.ChaincodeStubInterface) (string, error) {
+	config, err := readConfig(stub)
+	if err != nil {
+		return "", err
+	}
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return "", err
+	}
+	if config.RegulatorMSP == "" || mspID != config.RegulatorMSP {
+		return "", fmt.Errorf("only the regulator can perform this operation")
+	}
+	return mspID, nil
+}
+
+//读取许可证，不存在时返回nil
+func readLicence(stub shim.ChaincodeStubInterface, LicenceNo string) (*Licence, error) {
+	key, err := stub.CreateCompositeKey(licenceObjectType, []string{LicenceNo})
+	if err != nil {
+		return nil, err
+	}
+	LicenceAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if LicenceAsBytes == nil {
+		return nil, nil
+	}
+	var licence Licence
+	if err = json.Unmarshal(LicenceAsBytes, &licence); err != nil {
+		return nil, err
+	}
+	return &licence, nil
+}
+
+//保存许可证
+func writeLicence(stub shim.ChaincodeStubInterface, licence *Licence) ([]byte, error) {
+	key, err := stub.CreateCompositeKey(licenceObjectType, []string{licence.LicenceNo})
+	if err != nil {
+		return nil, err
+	}
+	LicenceAsBytes, err := json.Marshal(licence)
+	if err != nil {
+		return nil, err
+	}
+	return LicenceAsBytes, stub.PutState(key, LicenceAsBytes)
+}
+
+//校验生产信息的许可证：已登记、未吊销、生产日期在有效期内、持证人和生产范围一致
+//未配置监管机构时没有许可证登记，不做校验
+func checkLicence(stub shim.ChaincodeStubInterface, foodProInfo *ProInfo) error {
+	config, err := readConfig(stub)
+	if err != nil {
+		return err
+	}
+	if config.RegulatorMSP == "" {
+		return nil
+	}
+	licence, err := readLicence(stub, foodProInfo.FoodQSID)
+	if err != nil {
+		return err
+	}
+	if licence == nil {
+		return fmt.Errorf("licence %s not found", foodProInfo.FoodQSID)
+	}
+	if licence.Revoked {
+		return fmt.Errorf("licence %s has been revoked: %s", licence.LicenceNo, licence.RevokeReason)
+	}
+	FoodMFGDate, err := parseFoodDate(foodProInfo.FoodMFGDate)
+	if err != nil {
+		return err
+	}
+	ValidFrom, err := parseFoodDate(licence.ValidFrom)
+	if err != nil {
+		return err
+	}
+	ValidTo, err := parseExpiry(licence.ValidTo)
+	if err != nil {
+		return err
+	}
+	if FoodMFGDate.Before(ValidFrom) || !FoodMFGDate.Before(ValidTo) {
+		return fmt.Errorf("licence %s is not valid at FoodMFGDate %s", licence.LicenceNo, foodProInfo.FoodMFGDate)
+	}
+	if licence.Holder != foodProInfo.FoodMFRSName {
+		return fmt.Errorf("licence %s is held by %s, not %s", licence.LicenceNo, licence.Holder, foodProInfo.FoodMFRSName)
+	}
+	if licence.HolderMSP != "" && licence.HolderMSP != foodProInfo.FoodMFRSMSP {
+		return fmt.Errorf("licence %s is held by MSP %s", licence.LicenceNo, licence.HolderMSP)
+	}
+	if len(licence.Scope) > 0 {
+		inScope := false
+		for _, FoodName := range licence.Scope {
+			if FoodName == foodProInfo.FoodName {
+				inScope = true
+				break
+			}
+		}
+		if !inScope {
+			return fmt.Errorf("licence %s does not cover %s", licence.LicenceNo, foodProInfo.FoodName)
+		}
+	}
+	return nil
+}
+
+//校验调用者为生产该食品的生产商
+func checkManufacturer(stub shim.ChaincodeStubInterface, FoodID string) (*Writer, error) {
+	writer, err := checkRole(stub, roleManufacturer)
+	if err != nil {
+		return nil, err
+	}
+	foodProInfo, err := readProInfo(stub, FoodID)
+	if err != nil {
+		return nil, err
+	}
+	if foodProInfo == nil {
+		return nil, fmt.Errorf("FoodID %s not found", FoodID)
+	}
+	if err = checkFoodOwner(FoodID, foodProInfo, writer.MSPID); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+//校验食品归属的生产商组织；旧数据和迁移数据没有记录生产商组织，须由监管机构指定后才能修改
+func checkFoodOwner(FoodID string, foodProInfo *ProInfo, mspID string) error {
+	if foodProInfo.FoodMFRSMSP == "" {
+		return fmt.Errorf("FoodID %s has no owning manufacturer, the regulator must assign one first", FoodID)
+	}
+	if foodProInfo.FoodMFRSMSP != mspID {
+		return fmt.Errorf("only the manufacturer that created the food can change it")
+	}
+	return nil
+}
+
+//读取食品召回状态，未召回时返回nil
+func readFoodRecall(stub shim.ChaincodeStubInterface, FoodID string) (*FoodRecall, error) {
+	key, err := stub.CreateCompositeKey(foodRecallObjectType, []string{FoodID})
+	if err != nil {
+		return nil, err
+	}
+	FoodRecallAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if FoodRecallAsBytes == nil {
+		return nil, nil
+	}
+	var foodRecall FoodRecall
+	if err = json.Unmarshal(FoodRecallAsBytes, &foodRecall); err != nil {
+		return nil, err
+	}
+	return &foodRecall, nil
+}
+
+//从起始食品出发收集全部下游食品（含起始食品）
+func collectDownstream(stub shim.ChaincodeStubInterface, FoodIDs []string) ([]string, error) {
+	seen := make(map[string]bool)
+	queue := append([]string{}, FoodIDs...)
+	var result []string
+	for len(queue) > 0 {
+		FoodID := queue[0]
+		queue = queue[1:]
+		if seen[FoodID] {
+			continue
+		}
+		seen[FoodID] = true
+		result = append(result, FoodID)
+		var FoodLOT string
+		foodProInfo, err := readProInfo(stub, FoodID)
+		if err != nil {
+			return nil, err
+		}
+		if foodProInfo != nil {
+			FoodLOT = foodProInfo.FoodLOT
+		}
+		consumers, err := queryConsumers(stub, FoodID, FoodLOT)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, consumers...)
+	}
+	return uniqueSorted(result), nil
+}
+
+//发起召回，参数为召回对象类型（lot或ingredient）、批次号或配料ID、原因和召回等级
+//由监管机构或起始食品的生产商发起，该批次或配料的全部下游食品均被标记为召回
+func initiateRecall(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//判断参数合法性并解析参数
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments.")
+	}
+	var recall Recall
+	recall.TargetType = args[0]
+	recall.TargetID = args[1]
+	recall.Reason = args[2]
+	recall.Severity = args[3]
+	if recall.TargetID == "" || recall.Reason == "" {
+		return shim.Error("TargetID and Reason can not be empty")
+	}
+	if !recallSeverities[recall.Severity] {
+		return shim.Error("Severity must be one of I, II, III")
+	}
+	//确定起始食品：批次内全部食品，或使用该配料的食品及配料本身对应的食品
+	var seeds []string
+	var err error
+	switch recall.TargetType {
+	case "lot":
+		seeds, err = queryIndex(stub, lotIndex, recall.TargetID)
+	case "ingredient":
+		seeds, err = queryIndex(stub, ingIDIndex, recall.TargetID)
+		if err == nil {
+			var IngFoodIDs []string
+			IngFoodIDs, err = queryIndex(stub, ingIndex, recall.TargetID)
+			seeds = append(seeds, IngFoodIDs...)
+		}
+		if err == nil {
+			var IngProInfo *ProInfo
+			IngProInfo, err = readProInfo(stub, recall.TargetID)
+			if IngProInfo != nil {
+				seeds = append(seeds, recall.TargetID)
+			}
+		}
+	default:
+		return shim.Error("TargetType must be lot or ingredient")
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(seeds) == 0 {
+		return shim.Error(fmt.Sprintf("no food found for %s %s", recall.TargetType, recall.TargetID))
+	}
+	//权限校验：监管机构，或生产了全部起始食品的生产商
+	recall.InitiatedBy, err = cid.GetMSPID(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	config, err := readConfig(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if config.RegulatorMSP == "" || recall.InitiatedBy != config.RegulatorMSP {
+		ManufacturerFoods := seeds
+		if recall.TargetType == "ingredient" {
+			ManufacturerFoods = []string{recall.TargetID}
+		}
+		for _, FoodID := range ManufacturerFoods {
+			foodProInfo, err := readProInfo(stub, FoodID)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			if foodProInfo == nil || foodProInfo.FoodMFRSMSP != recall.InitiatedBy {
+				return shim.Error("only the regulator or the manufacturer can initiate the recall")
+			}
+		}
+	}
+	recall.FoodIDs, err = collectDownstream(stub, seeds)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	recall.RecallID = stub.GetTxID()
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	recall.InitiatedAt = now.Format(time.RFC3339)
+	//保存召回记录并标记每个受影响的食品
+	RecallAsBytes, err := json.Marshal(recall)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	key, err := stub.CreateCompositeKey(recallObjectType, []string{recall.RecallID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = stub.PutState(key, RecallAsBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	var FoodRecalls []FoodRecall
+	for _, FoodID := range recall.FoodIDs {
+		foodRecall := FoodRecall{FoodID: FoodID, RecallID: recall.RecallID, Reason: recall.Reason, Severity: recall.Severity}
+		FoodRecallAsBytes, err := json.Marshal(foodRecall)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		key, err := stub.CreateCompositeKey(foodRecallObjectType, []string{FoodID})
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if err = stub.PutState(key, FoodRecallAsBytes); err != nil {
+			return shim.Error(err.Error())
+		}
+		FoodRecalls = append(FoodRecalls, foodRecall)
+	}
+	//每个交易只能设置一个事件，事件内容为逐个食品的召回信息
+	EventAsBytes, err := json.Marshal(FoodRecalls)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = stub.SetEvent("FoodRecalled", EventAsBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(RecallAsBytes)
+}
+
+//获取召回记录
+func getRecall(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments.")
+	}
+	key, err := stub.CreateCompositeKey(recallObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	RecallAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if RecallAsBytes == nil {
+		return shim.Error("Recall not found")
+	}
+	return shim.Success(RecallAsBytes)
+}
+
+//获取食品召回状态，未召回时返回空
+func getFoodRecall(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments.")
+	}
+	foodRecall, err := readFoodRecall(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if foodRecall == nil {
+		return shim.Success(nil)
+	}
+	jsonAsBytes, err := json.Marshal(foodRecall)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(jsonAsBytes)
+}
+
+//设置产品温湿度范围，参数为食品名称和SensorRange的JSON
+//范围按调用者所属生产商组织保存，只作用于该组织生产的食品
+func setProductProfile(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments.")
+	}
+	FoodName := args[0]
+	if FoodName == "" {
+		return shim.Error("FoodName can not be empty")
+	}
+	writer, err := checkRole(stub, roleManufacturer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	var sensorRange SensorRange
+	if err = json.Unmarshal([]byte(args[1]), &sensorRange); err != nil {
+		return shim.Error(err.Error())
+	}
+	if sensorRange.TempMin != nil && sensorRange.TempMax != nil && *sensorRange.TempMin > *sensorRange.TempMax {
+		return shim.Error("TempMin can not be greater than TempMax")
+	}
+	if sensorRange.HumidityMin != nil && sensorRange.HumidityMax != nil && *sensorRange.HumidityMin > *sensorRange.HumidityMax {
+		return shim.Error("HumidityMin can not be greater than HumidityMax")
+	}
+	key, err := stub.CreateCompositeKey(profileObjectType, []string{writer.MSPID, FoodName})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	RangeAsBytes, err := json.Marshal(sensorRange)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = stub.PutState(key, RangeAsBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
+
+//确定食品的温湿度范围：以生产商的产品范围为基础，食品规格中写明的范围优先
+func readSensorRange(stub shim.ChaincodeStubInterface, foodProInfo *ProInfo) (SensorRange, error) {
+	var sensorRange SensorRange
+	key, err := stub.CreateCompositeKey(profileObjectType, []string{foodProInfo.FoodMFRSMSP, foodProInfo.FoodName})
+	if err != nil {
+		return sensorRange, err
+	}
+	RangeAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return sensorRange, err
+	}
+	if RangeAsBytes != nil {
+		if err = json.Unmarshal(RangeAsBytes, &sensorRange); err != nil {
+			return sensorRange, err
+		}
+	}
+	for _, match := range specRangeRegexp.FindAllStringSubmatch(foodProInfo.FoodSpec, -1) {
+		min, _ := strconv.ParseFloat(match[2], 64)
+		max, _ := strconv.ParseFloat(match[3], 64)
+		if match[1] == "temp" {
+			sensorRange.TempMin, sensorRange.TempMax = &min, &max
+		} else {
+			sensorRange.HumidityMin, sensorRange.HumidityMax = &min, &max
+		}
+	}
+	return sensorRange, nil
+}
+
+//检查单项读数是否超出范围
+func checkExcursion(reading SensorReading, metric string, value *float64, min, max *float64) *Excursion {
+	if value == nil {
+		return nil
+	}
+	if min != nil && *value < *min {
+		return &Excursion{SensorID: reading.SensorID, Time: reading.Time, Metric: metric, Value: *value, Limit: *min}
+	}
+	if max != nil && *value > *max {
+		return &Excursion{SensorID: reading.SensorID, Time: reading.Time, Metric: metric, Value: *value, Limit: *max}
+	}
+	return nil
+}
+
+//上传一批传感器读数，参数为FoodID、物流信息序号和SensorReading的JSON数组，超限读数自动记录
+func addSensorReadings(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//判断参数合法性并解析参数
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments.")
+	}
+	var sensorBatch SensorBatch
+	sensorBatch.FoodID = args[0]
+	if sensorBatch.FoodID == "" {
+		return shim.Error("FoodID can not be empty")
+	}
+	writer, err := checkRole(stub, roleLogistics)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	sensorBatch.Writer = writer
+	LogSeq, err := strconv.Atoi(args[1])
+	if err != nil || LogSeq < 0 {
+		return shim.Error("LogSeq must be a non-negative integer")
+	}
+	sensorBatch.LogSeq = LogSeq
+	if err = json.Unmarshal([]byte(args[2]), &sensorBatch.Readings); err != nil {
+		return shim.Error(err.Error())
+	}
+	if len(sensorBatch.Readings) == 0 || len(sensorBatch.Readings) > maxSensorReadings {
+		return shim.Error(fmt.Sprintf("number of readings must be between 1 and %d", maxSensorReadings))
+	}
+	for _, reading := range sensorBatch.Readings {
+		if _, err = time.Parse(time.RFC3339, reading.Time); err != nil {
+			return shim.Error(err.Error())
+		}
+		if reading.Temp == nil && reading.Humidity == nil {
+			return shim.Error("reading must contain Temp or Humidity")
+		}
+	}
+	//校验食品和物流信息存在，在途的物流信息序号为已有条数，并记录该段物流的发货方和收货方组织
+	foodProInfo, err := readProInfo(stub, sensorBatch.FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if foodProInfo == nil {
+		return shim.Error(fmt.Sprintf("FoodID %s not found", sensorBatch.FoodID))
 	}
-	FoodInfos.FoodProInfo.FoodName = args[1]
-	FoodInfos.FoodProInfo.FoodSpec = args[2]
-	FoodInfos.FoodProInfo.FoodMFGDate = args[3]
-	FoodInfos.FoodProInfo.FoodEXPDate = args[4]
-	FoodInfos.FoodProInfo.FoodLOT = args[5]
-	FoodInfos.FoodProInfo.FoodQSID = args[6]
-	FoodInfos.FoodProInfo.FoodMFRSName = args[7]
-	FoodInfos.FoodProInfo.FoodProPrice = args[8]
-	FoodInfos.FoodProInfo.FoodProPlace = args[9]
-	//对结构体进行序列化
-	ProInfosJSONasBytes, err := json.Marshal(FoodInfos)
+	LogInfos, err := readLogInfos(stub, sensorBatch.FoodID)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	//保存状态
-	err = stub.PutState(FoodInfos.FoodID, ProInfosJSONasBytes)
+	var Participants []string
+	if LogSeq == len(LogInfos) {
+		shipment, err := readShipment(stub, sensorBatch.FoodID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if shipment == nil {
+			return shim.Error(fmt.Sprintf("LogInfo %d not found", LogSeq))
+		}
+		if shipment.FoodLogInfo.Writer != nil {
+			Participants = append(Participants, shipment.FoodLogInfo.Writer.MSPID)
+		}
+		Participants = append(Participants, shipment.ReceiverMSP)
+	} else if LogSeq > len(LogInfos) {
+		return shim.Error(fmt.Sprintf("LogInfo %d not found", LogSeq))
+	} else {
+		for _, participant := range []*Writer{LogInfos[LogSeq].Writer, LogInfos[LogSeq].Receiver} {
+			if participant != nil {
+				Participants = append(Participants, participant.MSPID)
+			}
+		}
+	}
+	//只有该段物流的参与方可以上报传感器数据
+	isParticipant := false
+	for _, mspID := range Participants {
+		if mspID != "" && mspID == writer.MSPID {
+			isParticipant = true
+			break
+		}
+	}
+	if !isParticipant {
+		return shim.Error(fmt.Sprintf("MSP %s is not a participant of LogInfo %d", writer.MSPID, LogSeq))
+	}
+	//超限检测
+	sensorBatch.Range, err = readSensorRange(stub, foodProInfo)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	return shim.Success(nil)
-}
-
-//新增配料信息
-func addIngInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var FoodInfos FoodInfo
-	var IngInfoitem IngInfo
-	//判断参数合法性
-	if (len(args)-1)%2 != 0 || len(args) == 1 {
-		return shim.Error("Incorrect number of arguments.")
+	sensorBatch.Excursions = []Excursion{}
+	for _, reading := range sensorBatch.Readings {
+		if excursion := checkExcursion(reading, "temperature", reading.Temp, sensorBatch.Range.TempMin, sensorBatch.Range.TempMax); excursion != nil {
+			sensorBatch.Excursions = append(sensorBatch.Excursions, *excursion)
+		}
+		if excursion := checkExcursion(reading, "humidity", reading.Humidity, sensorBatch.Range.HumidityMin, sensorBatch.Range.HumidityMax); excursion != nil {
+			sensorBatch.Excursions = append(sensorBatch.Excursions, *excursion)
+		}
 	}
-	//参数解析
-	FoodID := args[0]
-	for i := 1; i < len(args); {
-		IngInfoitem.IngID = args[i]
-		IngInfoitem.IngName = args[i+1]
-		FoodInfos.FoodIngInfo = append(FoodInfos.FoodIngInfo, IngInfoitem)
-		i = i + 2
+	//保存状态
+	sensorBatch.TxID = stub.GetTxID()
+	key, err := stub.CreateCompositeKey(sensorObjectType, []string{sensorBatch.FoodID, fmt.Sprintf("%010d", LogSeq), sensorBatch.TxID})
+	if err != nil {
+		return shim.Error(err.Error())
 	}
-	FoodInfos.FoodID = FoodID
-	//结构体
-	IngInfoJsonAsBytes, err := json.Marshal(FoodInfos)
+	BatchAsBytes, err := json.Marshal(sensorBatch)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	//状态保存
-	err = stub.PutState(FoodInfos.FoodID, IngInfoJsonAsBytes)
+	if err = stub.PutState(key, BatchAsBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+	ExcursionsAsBytes, err := json.Marshal(sensorBatch.Excursions)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	return shim.Success(nil)
+	return shim.Success(ExcursionsAsBytes)
 }
 
-//获取食品全部信息
-func getFoodInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	//检查参数个数
+//按物流信息汇总食品的冷链超限情况，包括在途的物流信息
+func getExcursionSummary(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) != 1 {
 		return shim.Error("Incorrect number of arguments.")
 	}
-	//参数解析
 	FoodID := args[0]
-	//在世界状态中根据FoodID查询记录
-	resultIterator, err := stub.GetHistoryForKey(FoodID)
+	LogInfos, err := readLogInfos(stub, FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	shipment, err := readShipment(stub, FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if shipment != nil {
+		LogInfos = append(LogInfos, shipment.FoodLogInfo)
+	}
+	summaries := make([]ShipmentSummary, len(LogInfos))
+	for i, LogInfo := range LogInfos {
+		summaries[i] = ShipmentSummary{
+			LogSeq:         i,
+			LogDeparturePl: LogInfo.LogDeparturePl,
+			LogDest:        LogInfo.LogDest,
+			LogCopName:     LogInfo.LogCopName,
+			InTransit:      shipment != nil && i == len(LogInfos)-1,
+			Excursions:     []Excursion{},
+		}
+	}
+	resultIterator, err := stub.GetStateByPartialCompositeKey(sensorObjectType, []string{FoodID})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 	defer resultIterator.Close()
 
-	//迭代获取该FoodID对应的全部信息
-	var foodAllinfo FoodAllInfo
 	for resultIterator.HasNext() {
-		var FoodInfos FoodInfo
 		response, err := resultIterator.Next()
 		if err != nil {
 			return shim.Error(err.Error())
 		}
-		json.Unmarshal(response.Value, &FoodInfos)
-		if FoodInfos.FoodProInfo.FoodName != "" {
-			foodAllinfo.FoodProInfo = FoodInfos.FoodProInfo
-		} else if FoodInfos.FoodIngInfo != nil {
-			foodAllinfo.FoodIngInfo = FoodInfos.FoodIngInfo
-		} else if FoodInfos.FoodLogInfo.LogMission != "" {
-			foodAllinfo.FoodLogInfo = append(foodAllinfo.FoodLogInfo, FoodInfos.FoodLogInfo)
+		var sensorBatch SensorBatch
+		if err = json.Unmarshal(response.Value, &sensorBatch); err != nil {
+			return shim.Error(err.Error())
+		}
+		if sensorBatch.LogSeq >= len(summaries) {
+			continue
+		}
+		summary := &summaries[sensorBatch.LogSeq]
+		summary.Readings += len(sensorBatch.Readings)
+		summary.ExcursionCount += len(sensorBatch.Excursions)
+		summary.Excursions = append(summary.Excursions, sensorBatch.Excursions...)
+		for _, reading := range sensorBatch.Readings {
+			if reading.Temp == nil {
+				continue
+			}
+			if summary.TempMin == nil || *reading.Temp < *summary.TempMin {
+				summary.TempMin = reading.Temp
+			}
+			if summary.TempMax == nil || *reading.Temp > *summary.TempMax {
+				summary.TempMax = reading.Temp
+			}
 		}
 	}
-
-	//对结果进行序列化
-	jsonAsBytes, err := json.Marshal(foodAllinfo)
+	jsonAsBytes, err := json.Marshal(summaries)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	//运行成功并返回
 	return shim.Success(jsonAsBytes)
 }
 
-//新增物流信息
-func addLogInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var err error
-	var FoodInfos FoodInfo
-	//判断参数合法性并解析参数
-	if len(args) != 11 {
+//查询生产商或销售商在N天内到期的食品，参数为类型（manufacturer或seller）、名称和天数
+func getExpiringFoods(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
 		return shim.Error("Incorrect number of arguments.")
 	}
-	FoodInfos.FoodID = args[0]
-	if FoodInfos.FoodID == "" {
-		return shim.Error("FoodID can not be empty")
+	var index string
+	switch args[0] {
+	case "manufacturer":
+		index = mfrExpIndex
+	case "seller":
+		index = sellerExpIndex
+	default:
+		return shim.Error("type must be manufacturer or seller")
 	}
-	FoodInfos.FoodLogInfo.LogDepartureTm = args[1]
-	FoodInfos.FoodLogInfo.LogArrivalTm = args[2]
-	FoodInfos.FoodLogInfo.LogMission = args[3]
-	FoodInfos.FoodLogInfo.LogDeparturePl = args[4]
-	FoodInfos.FoodLogInfo.LogDest = args[5]
-	FoodInfos.FoodLogInfo.LogToSeller = args[6]
-	FoodInfos.FoodLogInfo.LogStorageTm = args[7]
-	FoodInfos.FoodLogInfo.LogMOT = args[8]
-	FoodInfos.FoodLogInfo.LogCopName = args[9]
-	FoodInfos.FoodLogInfo.LogCost = args[10]
-
-	//序列化
-	LogInfosJSONasBytes, err := json.Marshal(FoodInfos)
-	if err != nil {
-		return shim.Error(err.Error())
+	name := args[1]
+	if name == "" {
+		return shim.Error("name can not be empty")
 	}
-	//保存状态
-	err = stub.PutState(FoodInfos.FoodID, LogInfosJSONasBytes)
+	days, err := strconv.Atoi(args[2])
+	if err != nil || days < 0 {
+		return shim.Error("days must be a non-negative integer")
+	}
+	now, err := getTxTime(stub)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	return shim.Success(nil)
-}
-
-//获取食品基本生产信息
-func getProInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	//判断参数合法性并解析参数
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments.")
-	}
-	FoodID := args[0]
-	//根据FoodID查询信息
-	resultIterator, err := stub.GetHistoryForKey(FoodID)
+	deadline := now.AddDate(0, 0, days)
+	//索引按保质期排序，超出截止时间即可停止
+	resultIterator, err := stub.GetStateByPartialCompositeKey(index, []string{name})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 	defer resultIterator.Close()
 
-	//迭代赋值
-	var foodProInfo ProInfo
+	foods := []ExpiringFood{}
 	for resultIterator.HasNext() {
-		var FoodInfos FoodInfo
 		response, err := resultIterator.Next()
 		if err != nil {
 			return shim.Error(err.Error())
 		}
-		//反序列化
-		json.Unmarshal(response.Value, &FoodInfos)
-		if FoodInfos.FoodProInfo.FoodName != "" {
-			foodProInfo = FoodInfos.FoodProInfo
+		_, attrs, err := stub.SplitCompositeKey(response.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		expDate, err := time.Parse(time.RFC3339, attrs[1])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if expDate.Before(now) {
+			continue
+		}
+		if expDate.After(deadline) {
+			break
+		}
+		foodProInfo, err := readProInfo(stub, attrs[2])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if foodProInfo == nil {
 			continue
 		}
+		foods = append(foods, ExpiringFood{
+			FoodID:       attrs[2],
+			FoodName:     foodProInfo.FoodName,
+			FoodLOT:      foodProInfo.FoodLOT,
+			FoodEXPDate:  foodProInfo.FoodEXPDate,
+			FoodMFRSName: foodProInfo.FoodMFRSName,
+		})
 	}
-	//对结果进行序列化
-	jsonAsBytes, err := json.Marshal(foodProInfo)
+	jsonAsBytes, err := json.Marshal(foods)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	//返回
 	return shim.Success(jsonAsBytes)
 }
 
-//获取配料信息
-func getIngInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments.")
-	}
-	FoodID := args[0]
-	resultIterator, err := stub.GetHistoryForKey(FoodID)
+//查找写入键当前值的交易ID
+func latestTxID(stub shim.ChaincodeStubInterface, key string, value []byte) (string, error) {
+	resultIterator, err := stub.GetHistoryForKey(key)
 	if err != nil {
-		return shim.Error(err.Error())
+		return "", err
 	}
 	defer resultIterator.Close()
 
-	var foodIngInfo []IngInfo
+	var TxID string
+	var latest int64
 	for resultIterator.HasNext() {
-		var FoodInfos FoodInfo
 		response, err := resultIterator.Next()
 		if err != nil {
-			return shim.Error(err.Error())
+			return "", err
 		}
-		//反序列化
-		json.Unmarshal(response.Value, &FoodInfos)
-		if FoodInfos.FoodIngInfo != nil {
-			foodIngInfo = FoodInfos.FoodIngInfo
+		if response.IsDelete || !bytes.Equal(response.Value, value) {
 			continue
 		}
+		//历史记录的返回顺序与Fabric版本有关，按时间戳取最新的一条
+		timestamp := response.Timestamp.GetSeconds()*1e9 + int64(response.Timestamp.GetNanos())
+		if TxID == "" || timestamp >= latest {
+			TxID = response.TxId
+			latest = timestamp
+		}
 	}
-	jsonAsBytes, err := json.Marshal(foodIngInfo)
+	if TxID == "" {
+		return "", fmt.Errorf("no transaction found for current value of %s", key)
+	}
+	return TxID, nil
+}
+
+//读取记录当前值并生成账本记录引用，记录不存在时返回nil
+func traceRecord(stub shim.ChaincodeStubInterface, objectType string, attributes []string) (*traceverify.Record, []byte, error) {
+	key, err := stub.CreateCompositeKey(objectType, attributes)
 	if err != nil {
-		return shim.Error(err.Error())
+		return nil, nil, err
 	}
-	//返回
-	return shim.Success(jsonAsBytes)
+	value, err := stub.GetState(key)
+	if err != nil || value == nil {
+		return nil, nil, err
+	}
+	TxID, err := latestTxID(stub, key, value)
+	if err != nil {
+		return nil, nil, err
+	}
+	record := &traceverify.Record{ObjectType: objectType, Attributes: attributes, ValueHash: traceverify.HashValue(value), TxID: TxID}
+	return record, value, nil
 }
 
-//获取全部物流信息
-func getLogInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var LogInfos []LogInfo
+//生成面向消费者的溯源摘要（生产、配料、物流环节），附带支撑每条记录的交易ID和摘要哈希
+//区块号链码无法获取，由客户端补充后可用traceverify离线校验
+func getTraceSummary(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) != 1 {
 		return shim.Error("Incorrect number of arguments.")
 	}
 	FoodID := args[0]
-	resultIterator, err := stub.GetHistoryForKey(FoodID)
+	if FoodID == "" {
+		return shim.Error("FoodID can not be empty")
+	}
+	summary := traceverify.Summary{Version: traceverify.SummaryVersion, FoodID: FoodID, Records: []traceverify.Record{}}
+	//生产信息
+	record, value, err := traceRecord(stub, proObjectType, []string{FoodID})
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	defer resultIterator.Close()
-
-	for resultIterator.HasNext() {
-		var FoodInfos FoodInfo
-		response, err := resultIterator.Next()
+	if record == nil {
+		return shim.Error(fmt.Sprintf("FoodID %s not found", FoodID))
+	}
+	var foodProInfo ProInfo
+	if err = json.Unmarshal(value, &foodProInfo); err != nil {
+		return shim.Error(err.Error())
+	}
+	summary.Production = &traceverify.Production{
+		Name:         foodProInfo.FoodName,
+		LOT:          foodProInfo.FoodLOT,
+		MFGDate:      foodProInfo.FoodMFGDate,
+		EXPDate:      foodProInfo.FoodEXPDate,
+		Manufacturer: foodProInfo.FoodMFRSName,
+		QSID:         foodProInfo.FoodQSID,
+		Place:        foodProInfo.FoodProPlace,
+	}
+	summary.Records = append(summary.Records, *record)
+	//配料信息
+	record, value, err = traceRecord(stub, ingObjectType, []string{FoodID})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if record != nil {
+		var foodIngInfo []IngInfo
+		if err = json.Unmarshal(value, &foodIngInfo); err != nil {
+			return shim.Error(err.Error())
+		}
+		for _, IngInfoitem := range foodIngInfo {
+			summary.Ingredients = append(summary.Ingredients, traceverify.Ingredient{
+				ID:     IngInfoitem.IngID,
+				Name:   IngInfoitem.IngName,
+				FoodID: IngInfoitem.IngFoodID,
+				LOT:    IngInfoitem.IngLOT,
+			})
+		}
+		summary.Records = append(summary.Records, *record)
+	}
+	//物流环节
+	LogInfos, err := readLogInfos(stub, FoodID)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for i, LogInfo := range LogInfos {
+		record, _, err = traceRecord(stub, logObjectType, []string{FoodID, fmt.Sprintf("%010d", i)})
 		if err != nil {
 			return shim.Error(err.Error())
 		}
-		//反序列化
-		json.Unmarshal(response.Value, &FoodInfos)
-		if FoodInfos.FoodLogInfo.LogMission != "" {
-			LogInfos = append(LogInfos, FoodInfos.FoodLogInfo)
+		if record == nil {
+			return shim.Error(fmt.Sprintf("LogInfo %d not found", i))
 		}
+		summary.Hops = append(summary.Hops, traceverify.Hop{
+			From:      LogInfo.LogDeparturePl,
+			To:        LogInfo.LogDest,
+			Departure: LogInfo.LogDepartureTm,
+			Arrival:   LogInfo.LogArrivalTm,
+			Carrier:   LogInfo.LogCopName,
+		})
+		summary.Records = append(summary.Records, *record)
 	}
-	jsonAsBytes, err := json.Marshal(LogInfos)
+	summary.Digest, err = traceverify.ComputeDigest(&summary)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	jsonAsBytes, err := json.Marshal(summary)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	//返回
 	return shim.Success(jsonAsBytes)
 }
 
-//获取最新物流信息
-func getLogInfo_1(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var LogInfo LogInfo
+//登记或更新许可证，参数为Licence的JSON，仅监管机构可调用；已吊销的许可证不能再更新
+func registerLicence(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments.")
+	}
+	var licence Licence
+	if err := json.Unmarshal([]byte(args[0]), &licence); err != nil {
+		return shim.Error(err.Error())
+	}
+	if licence.LicenceNo == "" || licence.Holder == "" {
+		return shim.Error("LicenceNo and Holder can not be empty")
+	}
+	ValidFrom, err := parseFoodDate(licence.ValidFrom)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	ValidTo, err := parseFoodDate(licence.ValidTo)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if ValidTo.Before(ValidFrom) {
+		return shim.Error("ValidTo can not be before ValidFrom")
+	}
+	licence.IssuedBy, err = checkRegulator(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	oldLicence, err := readLicence(stub, licence.LicenceNo)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if oldLicence != nil && oldLicence.Revoked {
+		return shim.Error(fmt.Sprintf("licence %s has been revoked", licence.LicenceNo))
+	}
+	licence.Revoked = false
+	licence.RevokedAt = ""
+	licence.RevokeReason = ""
+	LicenceAsBytes, err := writeLicence(stub, &licence)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(LicenceAsBytes)
+}
+
+//吊销许可证，参数为许可证编号和原因，仅监管机构可调用
+func revokeLicence(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments.")
+	}
+	if args[1] == "" {
+		return shim.Error("reason can not be empty")
+	}
+	if _, err := checkRegulator(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	licence, err := readLicence(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if licence == nil {
+		return shim.Error("Licence not found")
+	}
+	if licence.Revoked {
+		return shim.Error(fmt.Sprintf("licence %s has been revoked", licence.LicenceNo))
+	}
+	now, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	licence.Revoked = true
+	licence.RevokedAt = now.Format(time.RFC3339)
+	licence.RevokeReason = args[1]
+	LicenceAsBytes, err := writeLicence(stub, licence)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(LicenceAsBytes)
+}
+
+//获取许可证
+func getLicence(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) != 1 {
 		return shim.Error("Incorrect number of arguments.")
 	}
+	licence, err := readLicence(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if licence == nil {
+		return shim.Error("Licence not found")
+	}
+	jsonAsBytes, err := json.Marshal(licence)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(jsonAsBytes)
+}
+
+//为未记录生产商组织的食品指定生产商组织，参数为FoodID和组织MSPID，仅监管机构可调用
+func assignManufacturer(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments.")
+	}
 	FoodID := args[0]
-	resultIterator, err := stub.GetHistoryForKey(FoodID)
+	if args[1] == "" {
+		return shim.Error("MSPID can not be empty")
+	}
+	if _, err := checkRegulator(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	foodProInfo, err := readProInfo(stub, FoodID)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	defer resultIterator.Close()
+	if foodProInfo == nil {
+		return shim.Error(fmt.Sprintf("FoodID %s not found", FoodID))
+	}
+	if foodProInfo.FoodMFRSMSP != "" {
+		return shim.Error(fmt.Sprintf("FoodID %s already belongs to %s", FoodID, foodProInfo.FoodMFRSMSP))
+	}
+	foodProInfo.FoodMFRSMSP = args[1]
+	if err = writeProInfo(stub, FoodID, *foodProInfo); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(nil)
+}
 
-	for resultIterator.HasNext() {
-		var FoodInfos FoodInfo
-		response, err := resultIterator.Next()
+//根据旧版FoodID键的历史记录重建分类存储的数据，迁移完成后删除旧键
+//参数为一个或多个FoodID，仅监管机构可调用，旧键已删除或已存在新格式数据的FoodID不能重复迁移
+func migrateFoodInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) == 0 {
+		return shim.Error("Incorrect number of arguments.")
+	}
+	if _, err := checkRegulator(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	var results []MigrateResult
+	for _, FoodID := range args {
+		if FoodID == "" {
+			return shim.Error("FoodID can not be empty")
+		}
+		//检查是否已经迁移
+		FoodAsBytes, err := stub.GetState(FoodID)
 		if err != nil {
 			return shim.Error(err.Error())
 		}
-		//反序列化
-		json.Unmarshal(response.Value, &FoodInfos)
-		if FoodInfos.FoodLogInfo.LogMission != "" {
-			LogInfo = FoodInfos.FoodLogInfo
-			continue
+		if FoodAsBytes == nil {
+			return shim.Error(fmt.Sprintf("FoodID %s has no legacy record to migrate", FoodID))
+		}
+		foodProInfo, err := readProInfo(stub, FoodID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		foodIngInfo, err := readIngInfo(stub, FoodID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		LogInfos, err := readLogInfos(stub, FoodID)
+		if err != nil {
+			return shim.Error(err.Error())
 		}
+		if foodProInfo != nil || foodIngInfo != nil || len(LogInfos) > 0 {
+			return shim.Error(fmt.Sprintf("FoodID %s already migrated", FoodID))
+		}
+		//历史记录的返回顺序与Fabric版本有关，先按时间戳升序排列
+		resultIterator, err := stub.GetHistoryForKey(FoodID)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		type historyValue struct {
+			timestamp int64
+			value     []byte
+		}
+		var histories []historyValue
+		for resultIterator.HasNext() {
+			response, err := resultIterator.Next()
+			if err != nil {
+				resultIterator.Close()
+				return shim.Error(err.Error())
+			}
+			if response.IsDelete {
+				continue
+			}
+			timestamp := response.Timestamp.GetSeconds()*1e9 + int64(response.Timestamp.GetNanos())
+			histories = append(histories, historyValue{timestamp, response.Value})
+		}
+		resultIterator.Close()
+		sort.SliceStable(histories, func(i, j int) bool { return histories[i].timestamp < histories[j].timestamp })
+		//按旧版查询逻辑重放历史记录：生产信息和配料信息取最后一次，物流信息全部保留
+		var foodAllinfo FoodAllInfo
+		hasProInfo := false
+		for _, history := range histories {
+			var FoodInfos FoodInfo
+			if err = json.Unmarshal(history.value, &FoodInfos); err != nil {
+				return shim.Error(fmt.Sprintf("FoodID %s history unmarshal error %s", FoodID, err))
+			}
+			if FoodInfos.FoodProInfo.FoodName != "" {
+				foodAllinfo.FoodProInfo = FoodInfos.FoodProInfo
+				hasProInfo = true
+			} else if FoodInfos.FoodIngInfo != nil {
+				foodAllinfo.FoodIngInfo = FoodInfos.FoodIngInfo
+			} else if FoodInfos.FoodLogInfo.LogMission != "" {
+				foodAllinfo.FoodLogInfo = append(foodAllinfo.FoodLogInfo, FoodInfos.FoodLogInfo)
+			}
+		}
+		//写入新格式
+		result := MigrateResult{FoodID: FoodID, ProInfo: hasProInfo, IngInfo: foodAllinfo.FoodIngInfo != nil, LogInfo: len(foodAllinfo.FoodLogInfo)}
+		if result.ProInfo {
+			if err = writeProInfo(stub, FoodID, foodAllinfo.FoodProInfo); err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+		if result.IngInfo {
+			if err = writeIngInfo(stub, FoodID, foodAllinfo.FoodIngInfo); err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+		for i, LogInfo := range foodAllinfo.FoodLogInfo {
+			if err = appendLogInfo(stub, FoodID, i, LogInfo); err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+		if result.ProInfo && result.LogInfo > 0 {
+			seller := foodAllinfo.FoodLogInfo[result.LogInfo-1].LogToSeller
+			if err = writeExpiryIndex(stub, sellerExpIndex, seller, FoodID, &foodAllinfo.FoodProInfo, false); err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+		//删除旧键，历史记录仍可通过GetHistoryForKey查询
+		if err = stub.DelState(FoodID); err != nil {
+			return shim.Error(err.Error())
+		}
+		results = append(results, result)
 	}
-	jsonAsBytes, err := json.Marshal(LogInfo)
+	jsonAsBytes, err := json.Marshal(results)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	//返回
 	return shim.Success(jsonAsBytes)
 }
+
 func main() {
 	if err := shim.Start(new(FoodChainCode)); err != nil {
 		fmt.Printf("Error starting Food ChainCode:%s", err)
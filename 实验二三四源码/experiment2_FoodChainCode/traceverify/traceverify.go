@@ -0,0 +1,466 @@
+// Package traceverify 定义面向消费者的食品溯源摘要，并提供离线校验：
+// 摘要中的每条记录都须由区块或网关查询到的有效交易写入，且写入值的哈希与摘要一致
+//
+// 本包不校验排序节点签名。按区块校验时，调用者须提供可信的区块头，例如从自己的节点获取，
+// 或用VerifyHeaderChain将区块头链接到可信的最新区块哈希；区块数据须与可信区块头的DataHash一致。
+// 交易有效性标记位于区块元数据中，不受DataHash保护，同样以提供区块的节点为准。
+package traceverify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// SummaryVersion 当前摘要格式版本
+const SummaryVersion = 1
+
+// Summary 溯源摘要，字段名简短以便编码进二维码
+type Summary struct {
+	Version     int          `json:"v"`
+	FoodID      string       `json:"id"`
+	Production  *Production  `json:"pro,omitempty"`
+	Ingredients []Ingredient `json:"ing,omitempty"`
+	Hops        []Hop        `json:"hops,omitempty"`
+	Records     []Record     `json:"recs"`   //支撑摘要内容的账本记录
+	Digest      string       `json:"digest"` //摘要内容的sha256，不含Digest和区块号
+}
+
+// Production 生产信息
+type Production struct {
+	Name         string `json:"n"`
+	LOT          string `json:"lot,omitempty"`
+	MFGDate      string `json:"mfg,omitempty"`
+	EXPDate      string `json:"exp,omitempty"`
+	Manufacturer string `json:"mfr,omitempty"`
+	QSID         string `json:"qs,omitempty"`
+	Place        string `json:"pl,omitempty"`
+}
+
+// Ingredient 配料
+type Ingredient struct {
+	ID     string `json:"id"`
+	Name   string `json:"n"`
+	FoodID string `json:"fid,omitempty"` //上游食品ID
+	LOT    string `json:"lot,omitempty"` //上游批次号
+}
+
+// Hop 物流环节
+type Hop struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Departure string `json:"dep,omitempty"`
+	Arrival   string `json:"arr,omitempty"`
+	Carrier   string `json:"by,omitempty"`
+}
+
+// Record 账本记录引用
+type Record struct {
+	ObjectType  string   `json:"t"`           //复合键对象类型
+	Attributes  []string `json:"a"`           //复合键属性
+	ValueHash   string   `json:"h"`           //记录值的sha256，十六进制
+	TxID        string   `json:"tx"`          //写入当前值的交易ID
+	BlockNumber uint64   `json:"b,omitempty"` //交易所在区块号，链码无法获取，由客户端通过GetBlockByTxID补充
+}
+
+//链码中记录的存储格式，仅包含摘要用到的字段
+type proRecord struct {
+	FoodName     string `json:"FoodName"`
+	FoodMFGDate  string `json:"FoodMFGDate"`
+	FoodEXPDate  string `json:"FoodEXPDate"`
+	FoodLOT      string `json:"FoodLOT"`
+	FoodQSID     string `json:"FoodQSID"`
+	FoodMFRSName string `json:"FoodMFRSName"`
+	FoodProPlace string `json:"FoodProPlace"`
+}
+
+type ingRecord struct {
+	IngID     string `json:"IngID"`
+	IngName   string `json:"IngName"`
+	IngFoodID string `json:"IngFoodID"`
+	IngLOT    string `json:"IngLOT"`
+}
+
+type logRecord struct {
+	LogDepartureTm string `json:"LogDepartureTm"`
+	LogArrivalTm   string `json:"LogArrivalTm"`
+	LogDeparturePl string `json:"LogDeparturePl"`
+	LogDest        string `json:"LogDest"`
+	LogCopName     string `json:"LogCopName"`
+}
+
+// CompositeKey 按Fabric规则拼接复合键
+func CompositeKey(objectType string, attributes []string) string {
+	key := "\x00" + objectType + "\x00"
+	for _, attr := range attributes {
+		key += attr + "\x00"
+	}
+	return key
+}
+
+// HashValue 计算记录值的哈希
+func HashValue(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
+
+// ComputeDigest 计算摘要内容的哈希，Digest和区块号不参与计算
+func ComputeDigest(s *Summary) (string, error) {
+	canonical := *s
+	canonical.Digest = ""
+	canonical.Records = make([]Record, len(s.Records))
+	for i, record := range s.Records {
+		record.BlockNumber = 0
+		canonical.Records[i] = record
+	}
+	data, err := json.Marshal(canonical)
+	if err != nil {
+		return "", err
+	}
+	return HashValue(data), nil
+}
+
+// VerifyDigest 校验摘要内容未被篡改
+func VerifyDigest(s *Summary) error {
+	if s.Version != SummaryVersion {
+		return fmt.Errorf("unsupported summary version %d", s.Version)
+	}
+	digest, err := ComputeDigest(s)
+	if err != nil {
+		return err
+	}
+	if digest != s.Digest {
+		return fmt.Errorf("summary digest mismatch")
+	}
+	return nil
+}
+
+// Verify 使用一组区块校验摘要：摘要哈希正确，区块数据与可信区块头一致，且每条记录都由其中的有效交易写入
+func Verify(s *Summary, blocks []*common.Block, trusted []*common.BlockHeader, namespace string) error {
+	if err := VerifyDigest(s); err != nil {
+		return err
+	}
+	if err := checkCoverage(s); err != nil {
+		return err
+	}
+	headers := make(map[uint64]*common.BlockHeader, len(trusted))
+	for _, header := range trusted {
+		if old, ok := headers[header.Number]; ok && !bytes.Equal(old.DataHash, header.DataHash) {
+			return fmt.Errorf("conflicting trusted headers for block %d", header.Number)
+		}
+		headers[header.Number] = header
+	}
+	verified := make([]bool, len(s.Records))
+	for _, block := range blocks {
+		if err := verifyBlock(s, block, headers, namespace, verified); err != nil {
+			return err
+		}
+	}
+	return checkAllVerified(s, verified)
+}
+
+// BlockDataHash 按Fabric规则计算区块数据哈希，即全部交易字节拼接后的sha256
+func BlockDataHash(data *common.BlockData) []byte {
+	sum := sha256.Sum256(bytes.Join(data.Data, nil))
+	return sum[:]
+}
+
+// HeaderHash 按Fabric规则计算区块头哈希，即区块号、前一区块哈希和数据哈希ASN.1编码后的sha256
+func HeaderHash(header *common.BlockHeader) ([]byte, error) {
+	data, err := asn1.Marshal(struct {
+		Number       *big.Int
+		PreviousHash []byte
+		DataHash     []byte
+	}{new(big.Int).SetUint64(header.Number), header.PreviousHash, header.DataHash})
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// VerifyHeaderChain 校验一组连续的区块头，且最后一个区块头的哈希等于可信的最新区块哈希
+func VerifyHeaderChain(headers []*common.BlockHeader, tipHash []byte) error {
+	if len(headers) == 0 {
+		return fmt.Errorf("no headers")
+	}
+	for i := 1; i < len(headers); i++ {
+		if headers[i].Number != headers[i-1].Number+1 {
+			return fmt.Errorf("headers are not consecutive at block %d", headers[i].Number)
+		}
+		previousHash, err := HeaderHash(headers[i-1])
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(headers[i].PreviousHash, previousHash) {
+			return fmt.Errorf("block %d does not link to block %d", headers[i].Number, headers[i-1].Number)
+		}
+	}
+	hash, err := HeaderHash(headers[len(headers)-1])
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(hash, tipHash) {
+		return fmt.Errorf("block %d does not match the trusted tip", headers[len(headers)-1].Number)
+	}
+	return nil
+}
+
+// VerifyTransactions 使用网关或qscc GetTransactionByID查询到的交易校验摘要，交易及其有效性以查询的节点为准
+func VerifyTransactions(s *Summary, txs []*peer.ProcessedTransaction, namespace string) error {
+	if err := VerifyDigest(s); err != nil {
+		return err
+	}
+	if err := checkCoverage(s); err != nil {
+		return err
+	}
+	verified := make([]bool, len(s.Records))
+	for _, tx := range txs {
+		if tx.ValidationCode != int32(peer.TxValidationCode_VALID) {
+			continue
+		}
+		if err := verifyEnvelope(s, tx.TransactionEnvelope, namespace, nil, verified); err != nil {
+			return err
+		}
+	}
+	return checkAllVerified(s, verified)
+}
+
+//检查摘要的每项内容都有对应记录：生产信息和配料各一条，每个物流环节恰好一条
+//记录与内容是否一致由checkContent在找到写入交易后校验
+func checkCoverage(s *Summary) error {
+	if s.FoodID == "" {
+		return fmt.Errorf("summary has no food id")
+	}
+	var pro, ing int
+	hops := make([]int, len(s.Hops))
+	for _, record := range s.Records {
+		switch record.ObjectType {
+		case "food~pro":
+			pro++
+		case "food~ing":
+			ing++
+		case "food~log":
+			if len(record.Attributes) != 2 {
+				return fmt.Errorf("invalid log record %v", record.Attributes)
+			}
+			seq, err := strconv.Atoi(record.Attributes[1])
+			if err != nil || seq < 0 || seq >= len(s.Hops) || record.Attributes[1] != fmt.Sprintf("%010d", seq) {
+				return fmt.Errorf("log record %v does not match any hop", record.Attributes)
+			}
+			hops[seq]++
+		default:
+			return fmt.Errorf("unknown record type %s", record.ObjectType)
+		}
+	}
+	if (s.Production != nil) != (pro == 1) || pro > 1 {
+		return fmt.Errorf("production must be backed by exactly one record, got %d", pro)
+	}
+	if (len(s.Ingredients) > 0 && ing != 1) || ing > 1 {
+		return fmt.Errorf("ingredients must be backed by exactly one record, got %d", ing)
+	}
+	for seq, count := range hops {
+		if count != 1 {
+			return fmt.Errorf("hop %d must be backed by exactly one record, got %d", seq, count)
+		}
+	}
+	return nil
+}
+
+//检查每条记录都已找到对应交易
+func checkAllVerified(s *Summary, verified []bool) error {
+	for i, ok := range verified {
+		if !ok {
+			return fmt.Errorf("record %s %v not backed by a valid transaction %s", s.Records[i].ObjectType, s.Records[i].Attributes, s.Records[i].TxID)
+		}
+	}
+	return nil
+}
+
+//校验区块数据与可信区块头一致，再校验其中的有效交易
+func verifyBlock(s *Summary, block *common.Block, trusted map[uint64]*common.BlockHeader, namespace string, verified []bool) error {
+	if block.Header == nil || block.Data == nil {
+		return fmt.Errorf("malformed block")
+	}
+	header, ok := trusted[block.Header.Number]
+	if !ok {
+		return fmt.Errorf("block %d has no trusted header", block.Header.Number)
+	}
+	if !bytes.Equal(BlockDataHash(block.Data), header.DataHash) {
+		return fmt.Errorf("block %d data does not match the trusted header", block.Header.Number)
+	}
+	var filter []byte
+	if block.Metadata != nil && len(block.Metadata.Metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		filter = block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+	for i, data := range block.Data.Data {
+		if i >= len(filter) || filter[i] != byte(peer.TxValidationCode_VALID) {
+			continue
+		}
+		env := new(common.Envelope)
+		if err := proto.Unmarshal(data, env); err != nil {
+			return fmt.Errorf("unmarshal envelope error %s", err)
+		}
+		blockNumber := block.Header.Number
+		if err := verifyEnvelope(s, env, namespace, &blockNumber, verified); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//校验交易写集中摘要引用的记录
+func verifyEnvelope(s *Summary, env *common.Envelope, namespace string, blockNumber *uint64, verified []bool) error {
+	txID, writes, err := envelopeWrites(env, namespace)
+	if err != nil || txID == "" {
+		return err
+	}
+	for i, record := range s.Records {
+		if record.TxID != txID {
+			continue
+		}
+		value, ok := writes[CompositeKey(record.ObjectType, record.Attributes)]
+		if !ok {
+			return fmt.Errorf("transaction %s does not write record %s %v", txID, record.ObjectType, record.Attributes)
+		}
+		if HashValue(value) != record.ValueHash {
+			return fmt.Errorf("record %s %v value hash mismatch", record.ObjectType, record.Attributes)
+		}
+		if err := checkContent(s, record, value); err != nil {
+			return err
+		}
+		if blockNumber != nil && record.BlockNumber != 0 && record.BlockNumber != *blockNumber {
+			return fmt.Errorf("record %s %v is in block %d, not %d", record.ObjectType, record.Attributes, *blockNumber, record.BlockNumber)
+		}
+		verified[i] = true
+	}
+	return nil
+}
+
+//校验摘要内容与记录值一致
+func checkContent(s *Summary, record Record, value []byte) error {
+	if len(record.Attributes) == 0 || record.Attributes[0] != s.FoodID {
+		return fmt.Errorf("record %s %v does not belong to food %s", record.ObjectType, record.Attributes, s.FoodID)
+	}
+	var match bool
+	switch record.ObjectType {
+	case "food~pro":
+		var pro proRecord
+		if err := json.Unmarshal(value, &pro); err != nil {
+			return err
+		}
+		match = s.Production != nil && *s.Production == Production{
+			Name:         pro.FoodName,
+			LOT:          pro.FoodLOT,
+			MFGDate:      pro.FoodMFGDate,
+			EXPDate:      pro.FoodEXPDate,
+			Manufacturer: pro.FoodMFRSName,
+			QSID:         pro.FoodQSID,
+			Place:        pro.FoodProPlace,
+		}
+	case "food~ing":
+		var ings []ingRecord
+		if err := json.Unmarshal(value, &ings); err != nil {
+			return err
+		}
+		match = len(ings) == len(s.Ingredients)
+		for i := 0; match && i < len(ings); i++ {
+			match = s.Ingredients[i] == Ingredient{ID: ings[i].IngID, Name: ings[i].IngName, FoodID: ings[i].IngFoodID, LOT: ings[i].IngLOT}
+		}
+	case "food~log":
+		var log logRecord
+		if err := json.Unmarshal(value, &log); err != nil {
+			return err
+		}
+		if len(record.Attributes) != 2 {
+			return fmt.Errorf("invalid log record %v", record.Attributes)
+		}
+		seq, err := strconv.Atoi(record.Attributes[1])
+		if err != nil {
+			return fmt.Errorf("invalid log record %v", record.Attributes)
+		}
+		match = seq < len(s.Hops) && s.Hops[seq] == Hop{
+			From:      log.LogDeparturePl,
+			To:        log.LogDest,
+			Departure: log.LogDepartureTm,
+			Arrival:   log.LogArrivalTm,
+			Carrier:   log.LogCopName,
+		}
+	default:
+		return fmt.Errorf("unknown record type %s", record.ObjectType)
+	}
+	if !match {
+		return fmt.Errorf("summary content does not match record %s %v", record.ObjectType, record.Attributes)
+	}
+	return nil
+}
+
+//解析背书交易，返回交易ID和指定链码命名空间的写集，非背书交易返回空交易ID
+func envelopeWrites(env *common.Envelope, namespace string) (string, map[string][]byte, error) {
+	payload := new(common.Payload)
+	if err := proto.Unmarshal(env.Payload, payload); err != nil {
+		return "", nil, fmt.Errorf("unmarshal payload error %s", err)
+	}
+	if payload.Header == nil {
+		return "", nil, fmt.Errorf("missing payload header")
+	}
+	channelHeader := new(common.ChannelHeader)
+	if err := proto.Unmarshal(payload.Header.ChannelHeader, channelHeader); err != nil {
+		return "", nil, fmt.Errorf("unmarshal channel header error %s", err)
+	}
+	if channelHeader.Type != int32(common.HeaderType_ENDORSER_TRANSACTION) {
+		return "", nil, nil
+	}
+	tx := new(peer.Transaction)
+	if err := proto.Unmarshal(payload.Data, tx); err != nil {
+		return "", nil, fmt.Errorf("unmarshal transaction error %s", err)
+	}
+	writes := make(map[string][]byte)
+	for _, action := range tx.Actions {
+		actionPayload := new(peer.ChaincodeActionPayload)
+		if err := proto.Unmarshal(action.Payload, actionPayload); err != nil {
+			return "", nil, fmt.Errorf("unmarshal action payload error %s", err)
+		}
+		if actionPayload.Action == nil {
+			continue
+		}
+		responsePayload := new(peer.ProposalResponsePayload)
+		if err := proto.Unmarshal(actionPayload.Action.ProposalResponsePayload, responsePayload); err != nil {
+			return "", nil, fmt.Errorf("unmarshal proposal response error %s", err)
+		}
+		chaincodeAction := new(peer.ChaincodeAction)
+		if err := proto.Unmarshal(responsePayload.Extension, chaincodeAction); err != nil {
+			return "", nil, fmt.Errorf("unmarshal chaincode action error %s", err)
+		}
+		txRWSet := new(rwset.TxReadWriteSet)
+		if err := proto.Unmarshal(chaincodeAction.Results, txRWSet); err != nil {
+			return "", nil, fmt.Errorf("unmarshal rwset error %s", err)
+		}
+		for _, nsRWSet := range txRWSet.NsRwset {
+			if nsRWSet.Namespace != namespace {
+				continue
+			}
+			kvRWSet := new(kvrwset.KVRWSet)
+			if err := proto.Unmarshal(nsRWSet.Rwset, kvRWSet); err != nil {
+				return "", nil, fmt.Errorf("unmarshal kvrwset error %s", err)
+			}
+			for _, write := range kvRWSet.Writes {
+				if !write.IsDelete {
+					writes[write.Key] = write.Value
+				}
+			}
+		}
+	}
+	return channelHeader.TxId, writes, nil
+}
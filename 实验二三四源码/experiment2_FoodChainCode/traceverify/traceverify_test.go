@@ -0,0 +1,265 @@
+package traceverify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+const testNamespace = "food"
+
+//构造写入指定键值的背书交易
+func testEnvelope(t *testing.T, txID string, writes map[string][]byte) []byte {
+	kvRWSet := &kvrwset.KVRWSet{}
+	for key, value := range writes {
+		kvRWSet.Writes = append(kvRWSet.Writes, &kvrwset.KVWrite{Key: key, Value: value})
+	}
+	marshal := func(m proto.Message) []byte {
+		data, err := proto.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	txRWSet := marshal(&rwset.TxReadWriteSet{NsRwset: []*rwset.NsReadWriteSet{{Namespace: testNamespace, Rwset: marshal(kvRWSet)}}})
+	responsePayload := marshal(&peer.ProposalResponsePayload{Extension: marshal(&peer.ChaincodeAction{Results: txRWSet})})
+	actionPayload := marshal(&peer.ChaincodeActionPayload{Action: &peer.ChaincodeEndorsedAction{ProposalResponsePayload: responsePayload}})
+	tx := marshal(&peer.Transaction{Actions: []*peer.TransactionAction{{Payload: actionPayload}}})
+	channelHeader := marshal(&common.ChannelHeader{Type: int32(common.HeaderType_ENDORSER_TRANSACTION), TxId: txID})
+	payload := marshal(&common.Payload{Header: &common.Header{ChannelHeader: channelHeader}, Data: tx})
+	return marshal(&common.Envelope{Payload: payload})
+}
+
+//构造全部交易有效的区块
+func testBlock(number uint64, previousHash []byte, envelopes ...[]byte) *common.Block {
+	dataHash := sha256.Sum256(bytes.Join(envelopes, nil))
+	filter := make([]byte, len(envelopes))
+	return &common.Block{
+		Header:   &common.BlockHeader{Number: number, PreviousHash: previousHash, DataHash: dataHash[:]},
+		Data:     &common.BlockData{Data: envelopes},
+		Metadata: &common.BlockMetadata{Metadata: [][]byte{nil, nil, filter}},
+	}
+}
+
+//构造包含生产信息、一条配料和一个物流环节的摘要及对应区块
+func testSummary(t *testing.T) (*Summary, []*common.Block) {
+	values := map[string][]byte{
+		"pro": []byte(`{"FoodName":"milk","FoodLOT":"L1","FoodMFRSName":"acme"}`),
+		"ing": []byte(`[{"IngID":"i1","IngName":"cow milk"}]`),
+		"log": []byte(`{"LogDeparturePl":"a","LogDest":"b","LogCopName":"co"}`),
+	}
+	s := &Summary{
+		Version:     SummaryVersion,
+		FoodID:      "f1",
+		Production:  &Production{Name: "milk", LOT: "L1", Manufacturer: "acme"},
+		Ingredients: []Ingredient{{ID: "i1", Name: "cow milk"}},
+		Hops:        []Hop{{From: "a", To: "b", Carrier: "co"}},
+		Records: []Record{
+			{ObjectType: "food~pro", Attributes: []string{"f1"}, ValueHash: HashValue(values["pro"]), TxID: "tx1"},
+			{ObjectType: "food~ing", Attributes: []string{"f1"}, ValueHash: HashValue(values["ing"]), TxID: "tx2"},
+			{ObjectType: "food~log", Attributes: []string{"f1", "0000000000"}, ValueHash: HashValue(values["log"]), TxID: "tx3"},
+		},
+	}
+	var blocks []*common.Block
+	for i, name := range []string{"pro", "ing", "log"} {
+		record := s.Records[i]
+		env := testEnvelope(t, record.TxID, map[string][]byte{CompositeKey(record.ObjectType, record.Attributes): values[name]})
+		var previousHash []byte
+		if i > 0 {
+			hash, err := HeaderHash(blocks[i-1].Header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			previousHash = hash
+		}
+		blocks = append(blocks, testBlock(uint64(10+i), previousHash, env))
+	}
+	return s, blocks
+}
+
+//复制区块头作为调用者可信的区块头
+func testHeaders(blocks []*common.Block) []*common.BlockHeader {
+	var headers []*common.BlockHeader
+	for _, block := range blocks {
+		header := *block.Header
+		headers = append(headers, &header)
+	}
+	return headers
+}
+
+//修改摘要后重新计算摘要哈希，模拟伪造者
+func resign(t *testing.T, s *Summary) {
+	digest, err := ComputeDigest(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Digest = digest
+}
+
+func TestVerify(t *testing.T) {
+	s, blocks := testSummary(t)
+	resign(t, s)
+	if err := Verify(s, blocks, testHeaders(blocks), testNamespace); err != nil {
+		t.Fatal(err)
+	}
+	s.Records[2].BlockNumber = 12
+	if err := Verify(s, blocks, testHeaders(blocks), testNamespace); err != nil {
+		t.Fatal(err)
+	}
+	s.Records[2].BlockNumber = 11
+	if err := Verify(s, blocks, testHeaders(blocks), testNamespace); err == nil {
+		t.Fatal("expected block number mismatch")
+	}
+}
+
+func TestVerifyDigest(t *testing.T) {
+	s, blocks := testSummary(t)
+	resign(t, s)
+	s.Production.Name = "cheese"
+	if err := Verify(s, blocks, testHeaders(blocks), testNamespace); err == nil {
+		t.Fatal("expected digest mismatch")
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Summary
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	decoded.Production.Name = "milk"
+	if err = VerifyDigest(&decoded); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyMissingBlock(t *testing.T) {
+	s, blocks := testSummary(t)
+	resign(t, s)
+	if err := Verify(s, blocks[:2], testHeaders(blocks), testNamespace); err == nil {
+		t.Fatal("expected unbacked record")
+	}
+}
+
+func TestVerifyInvalidTransaction(t *testing.T) {
+	s, blocks := testSummary(t)
+	resign(t, s)
+	blocks[0].Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER][0] = byte(peer.TxValidationCode_MVCC_READ_CONFLICT)
+	if err := Verify(s, blocks, testHeaders(blocks), testNamespace); err == nil {
+		t.Fatal("expected invalid transaction to be ignored")
+	}
+}
+
+func TestVerifyContentMismatch(t *testing.T) {
+	s, blocks := testSummary(t)
+	s.Hops[0].To = "c"
+	resign(t, s)
+	if err := Verify(s, blocks, testHeaders(blocks), testNamespace); err == nil {
+		t.Fatal("expected content mismatch")
+	}
+}
+
+func TestVerifyUnbackedContent(t *testing.T) {
+	//伪造者添加没有记录支撑的内容并重新计算摘要哈希
+	s, blocks := testSummary(t)
+	s.Hops = append(s.Hops, Hop{From: "b", To: "c"})
+	resign(t, s)
+	if err := Verify(s, blocks, testHeaders(blocks), testNamespace); err == nil {
+		t.Fatal("expected unbacked hop")
+	}
+
+	s, blocks = testSummary(t)
+	s.Records = s.Records[:2]
+	resign(t, s)
+	if err := Verify(s, blocks, testHeaders(blocks), testNamespace); err == nil {
+		t.Fatal("expected unbacked hop")
+	}
+
+	s, blocks = testSummary(t)
+	s.Records = s.Records[1:]
+	resign(t, s)
+	if err := Verify(s, blocks, testHeaders(blocks), testNamespace); err == nil {
+		t.Fatal("expected unbacked production")
+	}
+
+	s, blocks = testSummary(t)
+	s.Records = append(s.Records[:1], s.Records[2])
+	resign(t, s)
+	if err := Verify(s, blocks, testHeaders(blocks), testNamespace); err == nil {
+		t.Fatal("expected unbacked ingredients")
+	}
+
+	s, blocks = testSummary(t)
+	s.Records = append(s.Records, s.Records[2])
+	resign(t, s)
+	if err := Verify(s, blocks, testHeaders(blocks), testNamespace); err == nil {
+		t.Fatal("expected duplicate hop record")
+	}
+}
+
+func TestVerifyTransactions(t *testing.T) {
+	s, blocks := testSummary(t)
+	resign(t, s)
+	var txs []*peer.ProcessedTransaction
+	for _, block := range blocks {
+		env := new(common.Envelope)
+		if err := proto.Unmarshal(block.Data.Data[0], env); err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, &peer.ProcessedTransaction{TransactionEnvelope: env, ValidationCode: int32(peer.TxValidationCode_VALID)})
+	}
+	if err := VerifyTransactions(s, txs, testNamespace); err != nil {
+		t.Fatal(err)
+	}
+	txs[1].ValidationCode = int32(peer.TxValidationCode_MVCC_READ_CONFLICT)
+	if err := VerifyTransactions(s, txs, testNamespace); err == nil {
+		t.Fatal("expected invalid transaction to be ignored")
+	}
+}
+
+func TestVerifyTrustedHeaders(t *testing.T) {
+	s, blocks := testSummary(t)
+	resign(t, s)
+	if err := Verify(s, blocks, testHeaders(blocks[1:]), testNamespace); err == nil {
+		t.Fatal("expected block without trusted header")
+	}
+	//伪造者把写入记录的交易拼接进自造的区块，并修改区块自身的区块头
+	trusted := testHeaders(blocks)
+	forged := testBlock(blocks[2].Header.Number, blocks[2].Header.PreviousHash, blocks[2].Data.Data[0], blocks[0].Data.Data[0])
+	if err := Verify(s, []*common.Block{blocks[0], blocks[1], forged}, trusted, testNamespace); err == nil {
+		t.Fatal("expected data hash mismatch")
+	}
+	trusted[2] = forged.Header
+	if err := Verify(s, []*common.Block{blocks[0], blocks[1], forged}, append(trusted, testHeaders(blocks)[2]), testNamespace); err == nil {
+		t.Fatal("expected conflicting trusted headers")
+	}
+}
+
+func TestVerifyHeaderChain(t *testing.T) {
+	_, blocks := testSummary(t)
+	headers := testHeaders(blocks)
+	tipHash, err := HeaderHash(headers[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyHeaderChain(headers, tipHash); err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyHeaderChain(headers[:2], tipHash); err == nil {
+		t.Fatal("expected tip mismatch")
+	}
+	headers[1].DataHash = BlockDataHash(&common.BlockData{Data: [][]byte{[]byte("forged")}})
+	if err = VerifyHeaderChain(headers, tipHash); err == nil {
+		t.Fatal("expected broken link")
+	}
+	if err = VerifyHeaderChain([]*common.BlockHeader{headers[0], headers[2]}, tipHash); err == nil {
+		t.Fatal("expected non-consecutive headers")
+	}
+}